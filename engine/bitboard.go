@@ -61,6 +61,11 @@ func (bb Bitboard) Msb() int {
 	return int(bits.TrailingZeros64(uint64(bb)))
 }
 
+// Get the highest set square of the bitboard.
+func (bb Bitboard) HighestBit() int {
+	return 63 - bits.LeadingZeros64(uint64(bb))
+}
+
 func (bb Bitboard) String() string {
 	bbString := ""
 	var shiftMe Bitboard = 1
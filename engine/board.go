@@ -2,6 +2,7 @@ package engine
 
 import (
 	"fmt"
+	"strconv"
 	"strings"
 )
 
@@ -51,6 +52,9 @@ const (
 type BoardStruct struct {
 	Hash uint64
 
+	// The hash of the pawns alone, the key of the pawn hash table.
+	PawnHash uint64
+
 	Squares [64]uint8
 	Pieces  [13]Bitboard
 	Pawns   [3]Bitboard
@@ -65,10 +69,24 @@ type BoardStruct struct {
 	Ply        int
 	HistoryPly int
 
+	// The number of plies played in the game before the position the
+	// history starts from, for the fullmove number of the FEN.
+	StartPly int
+
 	History [maxGameMoves]State
 
-	SearchHistory [13][64]uint16
-	SearchKillers [2][MaxDepth]Move
+	// The NNUE network the accumulator is kept up to date for, nil when
+	// the position isn't evaluated by NNUE.
+	Net *Network
+	Acc Accumulator
+
+	// The pawn hash table the evaluation caches pawn structures in, nil
+	// if they aren't cached.
+	PawnTable *PawnTable
+
+	// The check and pin masks of the last position IsLegal was asked
+	// about, so checking several moves computes them only once.
+	legal legalInfo
 }
 
 type State struct {
@@ -107,10 +125,12 @@ func (pos *BoardStruct) ResetBoard() {
 
 	pos.Ply = 0
 	pos.HistoryPly = 0
+	pos.StartPly = 0
 
 	pos.CastlePerm = 0
 
 	pos.Hash = 0
+	pos.PawnHash = 0
 }
 
 func (pos *BoardStruct) UpdateListsMaterial() {
@@ -138,7 +158,28 @@ func (pos *BoardStruct) UpdateListsMaterial() {
 	}
 }
 
+// DoMove makes the move and reports whether it is legal. A move leaving
+// the king in check is taken back right away.
 func (pos *BoardStruct) DoMove(move Move) bool {
+	if !pos.makeMove(move) {
+		return false
+	}
+
+	kingBB := pos.Pieces[AllPieces[pos.SideToMove^1][King]]
+
+	if SqAttacked(kingBB.Msb(), pos, pos.SideToMove) {
+		pos.UndoMove()
+
+		return false
+	}
+
+	return true
+}
+
+// makeMove makes the move without checking whether it leaves the king in
+// check, for moves known to be legal like those of the move picker. It
+// only fails for a castling move to a square castling can't go to.
+func (pos *BoardStruct) makeMove(move Move) bool {
 	from := move.FromSq()
 	to := move.ToSq()
 
@@ -232,14 +273,6 @@ func (pos *BoardStruct) DoMove(move Move) bool {
 	pos.SideToMove ^= 1
 	pos.Hash ^= SideKey
 
-	kingBB := pos.Pieces[AllPieces[side][King]]
-
-	if SqAttacked(kingBB.Msb(), pos, pos.SideToMove) {
-		pos.UndoMove()
-
-		return false
-	}
-
 	return true
 }
 
@@ -312,20 +345,63 @@ func (pos *BoardStruct) UndoMove() {
 }
 
 func (pos *BoardStruct) MoveExists(move Move) bool {
-	var list MoveList
-	GenerateAllMoves(pos, &list, true)
+	return pos.IsLegal(move)
+}
 
-	for moveNum := 0; moveNum < list.Count; moveNum++ {
-		if !pos.DoMove(list.Moves[moveNum]) {
-			continue
-		}
-		pos.UndoMove()
-		if list.Moves[moveNum].Equal(move) {
-			return true
-		}
+// Pass the turn to the opponent, used by null move pruning. The fifty move
+// counter is reset so repetition detection doesn't look past the null move.
+func (pos *BoardStruct) DoNullMove() {
+	pos.History[pos.HistoryPly] = State{
+		Hash:       pos.Hash,
+		Move:       NoMove,
+		Captured:   Empty,
+		Rule50:     pos.Rule50,
+		EnPas:      pos.EnPas,
+		CastlePerm: pos.CastlePerm,
+	}
+
+	if pos.EnPas != NoSq {
+		pos.Hash ^= PieceKeys[Empty][pos.EnPas]
 	}
 
-	return false
+	pos.EnPas = NoSq
+	pos.Rule50 = 0
+
+	pos.HistoryPly++
+	pos.Ply++
+
+	pos.SideToMove ^= 1
+	pos.Hash ^= SideKey
+}
+
+func (pos *BoardStruct) UndoNullMove() {
+	pos.HistoryPly--
+	pos.Ply--
+
+	prevState := pos.History[pos.HistoryPly]
+
+	pos.Hash = prevState.Hash
+	pos.Rule50 = prevState.Rule50
+	pos.EnPas = prevState.EnPas
+	pos.CastlePerm = prevState.CastlePerm
+
+	pos.SideToMove ^= 1
+}
+
+// InCheck reports whether the side to move is in check.
+func (pos *BoardStruct) InCheck() bool {
+	kingBB := pos.Pieces[AllPieces[pos.SideToMove][King]]
+
+	return SqAttacked(kingBB.Msb(), pos, pos.SideToMove^1)
+}
+
+// IsCapture reports whether the move captures a piece, en passant included.
+func (pos *BoardStruct) IsCapture(move Move) bool {
+	if move.MoveType() == Attack && move.Flag() == AttackEP {
+		return true
+	}
+
+	return pos.Squares[move.ToSq()] != Empty
 }
 
 func (pos *BoardStruct) MovePiece(from int, to int) {
@@ -344,11 +420,16 @@ func (pos *BoardStruct) MovePiece(from int, to int) {
 	pos.Hash ^= PieceKeys[piece][to]
 	pos.Squares[to] = piece
 
+	if pos.Net != nil {
+		pos.Acc.move(pos.Net, piece, from, to)
+	}
+
 	if !PieceBig[piece] {
 		pos.Pawns[col].ClearBit(from)
 		pos.Pawns[Both].ClearBit(from)
 		pos.Pawns[col].SetBit(to)
 		pos.Pawns[Both].SetBit(to)
+		pos.PawnHash ^= PieceKeys[piece][from] ^ PieceKeys[piece][to]
 	}
 }
 
@@ -362,9 +443,14 @@ func (pos *BoardStruct) AddPiece(sq int, piece uint8) {
 	pos.Sides[Both].SetBit(sq)
 	pos.Pieces[piece].SetBit(sq)
 
+	if pos.Net != nil {
+		pos.Acc.add(pos.Net, piece, sq)
+	}
+
 	if !PieceBig[piece] {
 		pos.Pawns[col].SetBit(sq)
 		pos.Pawns[Both].SetBit(sq)
+		pos.PawnHash ^= PieceKeys[piece][sq]
 	}
 }
 
@@ -380,67 +466,271 @@ func (pos *BoardStruct) ClearPiece(sq int) {
 	pos.Pieces[piece].ClearBit(sq)
 	pos.Squares[sq] = Empty
 
+	if pos.Net != nil {
+		pos.Acc.remove(pos.Net, piece, sq)
+	}
+
 	if !PieceBig[piece] {
 		pos.Pawns[col].ClearBit(sq)
 		pos.Pawns[Both].ClearBit(sq)
+		pos.PawnHash ^= PieceKeys[piece][sq]
 	}
 }
 
-func (pos *BoardStruct) ParseFen(fen string) {
+// ParseFen sets up the position described by the FEN string. Malformed or
+// illegal positions are reported as an error, the board is left in an
+// undefined state then. The move counters may be left out.
+func (pos *BoardStruct) ParseFen(fen string) error {
 
 	pos.ResetBoard()
 
 	// Load in each field of the FEN string.
 	fields := strings.Fields(fen)
+	if len(fields) < 4 || len(fields) > 6 {
+		return fmt.Errorf("expected 4 to 6 fields, got %d", len(fields))
+	}
+
 	pieces := fields[0]
 	color := fields[1]
 	castling := fields[2]
 	ep := fields[3]
 
-	// Loop over each square of the board, rank by rank, from left to right,
-	// loading in pieces at squares described by the FEN string.
-	for index, sq := 0, uint8(56); index < len(pieces); index++ {
-		char := pieces[index]
-		switch char {
-		case 'p', 'n', 'b', 'r', 'q', 'k', 'P', 'N', 'B', 'R', 'Q', 'K':
-			piece := CharToPiece[char]
-			pos.Squares[sq] = piece
-			sq++
-		case '/':
-			sq -= 16
-		case '1', '2', '3', '4', '5', '6', '7', '8':
-			sq += pieces[index] - '0'
+	// Load in the pieces rank by rank, from the eighth rank down and from
+	// left to right.
+	ranks := strings.Split(pieces, "/")
+	if len(ranks) != 8 {
+		return fmt.Errorf("expected 8 ranks, got %d", len(ranks))
+	}
+
+	for index, rankStr := range ranks {
+		rank := R8 - index
+		file := FA
+
+		for i := 0; i < len(rankStr); i++ {
+			char := rankStr[i]
+
+			if char >= '1' && char <= '8' {
+				file += int(char - '0')
+				continue
+			}
+
+			piece, ok := CharToPiece[char]
+			if !ok {
+				return fmt.Errorf("invalid character %q on rank %d", char, rank+1)
+			}
+
+			if file > FH {
+				return fmt.Errorf("rank %d has more than 8 squares", rank+1)
+			}
+
+			if !PieceBig[piece] && (rank == R1 || rank == R8) {
+				return fmt.Errorf("pawn on rank %d", rank+1)
+			}
+
+			pos.Squares[FR2SQ(file, rank)] = piece
+			file++
+		}
+
+		if file != FH+1 {
+			return fmt.Errorf("rank %d has %d squares instead of 8", rank+1, file)
 		}
 	}
 
 	// Set the side to move for the position.
-	pos.SideToMove = Black
-	if color == "w" {
+	switch color {
+	case "w":
 		pos.SideToMove = White
+	case "b":
+		pos.SideToMove = Black
+	default:
+		return fmt.Errorf("invalid side to move %s", color)
+	}
+
+	if castling != "-" {
+		for _, char := range castling {
+			var perm uint8
+
+			switch char {
+			case 'K':
+				perm = wKCastle
+			case 'Q':
+				perm = wQCastle
+			case 'k':
+				perm = bKCastle
+			case 'q':
+				perm = bQCastle
+			default:
+				return fmt.Errorf("invalid castling rights %s", castling)
+			}
+
+			if pos.CastlePerm&perm != 0 {
+				return fmt.Errorf("invalid castling rights %s", castling)
+			}
+
+			pos.CastlePerm |= perm
+		}
 	}
 
 	if ep != "-" {
+		if len(ep) != 2 || ep[0] < 'a' || ep[0] > 'h' || ep[1] < '1' || ep[1] > '8' {
+			return fmt.Errorf("invalid en passant square %s", ep)
+		}
+
 		file := ep[0] - 'a'
 		rank := int(ep[1]-'0') - 1
 
 		pos.EnPas = FR2SQ(int(file), rank)
 	}
 
-	for _, char := range castling {
-		switch char {
-		case 'K':
-			pos.CastlePerm |= wKCastle
-		case 'Q':
-			pos.CastlePerm |= wQCastle
-		case 'k':
-			pos.CastlePerm |= bKCastle
-		case 'q':
-			pos.CastlePerm |= bQCastle
+	if len(fields) > 4 {
+		rule50, err := strconv.Atoi(fields[4])
+		if err != nil || rule50 < 0 {
+			return fmt.Errorf("invalid halfmove clock %s", fields[4])
 		}
+
+		pos.Rule50 = rule50
+	}
+
+	if len(fields) > 5 {
+		fullMove, err := strconv.Atoi(fields[5])
+		if err != nil || fullMove < 1 {
+			return fmt.Errorf("invalid fullmove number %s", fields[5])
+		}
+
+		pos.StartPly = 2 * (fullMove - 1)
+	}
+
+	if pos.SideToMove == Black {
+		pos.StartPly++
 	}
 
 	pos.Hash = GeneratePosKey(pos)
+	pos.PawnHash = GeneratePawnKey(pos)
 	pos.UpdateListsMaterial()
+
+	if err := pos.validate(); err != nil {
+		return err
+	}
+
+	if pos.Net != nil {
+		pos.Acc.Refresh(pos.Net, pos)
+	}
+
+	return nil
+}
+
+var sideNames = [2]string{"white", "black"}
+
+// Check that the position set up from a FEN string can occur in a game,
+// as far as the engine relies on it.
+func (pos *BoardStruct) validate() error {
+	for side := White; side <= Black; side++ {
+		if kings := pos.Pieces[AllPieces[side][King]].CountBits(); kings != 1 {
+			return fmt.Errorf("%s has %d kings", sideNames[side], kings)
+		}
+	}
+
+	castlePieces := []struct {
+		perm  uint8
+		king  int
+		rook  int
+		side  uint8
+		right string
+	}{
+		{wKCastle, E1, H1, White, "K"},
+		{wQCastle, E1, A1, White, "Q"},
+		{bKCastle, E8, H8, Black, "k"},
+		{bQCastle, E8, A8, Black, "q"},
+	}
+
+	for _, castle := range castlePieces {
+		if pos.CastlePerm&castle.perm == 0 {
+			continue
+		}
+
+		if pos.Squares[castle.king] != AllPieces[castle.side][King] || pos.Squares[castle.rook] != AllPieces[castle.side][Rook] {
+			return fmt.Errorf("castling right %s without the king and rook on their squares", castle.right)
+		}
+	}
+
+	if pos.EnPas != NoSq {
+		// The square must have been passed by a pawn of the side not to
+		// move with a double push in the last move.
+		pushed, behind, rank := pos.EnPas-8, pos.EnPas+8, R6
+		if pos.SideToMove == Black {
+			pushed, behind, rank = pos.EnPas+8, pos.EnPas-8, R3
+		}
+
+		if RankOf(pos.EnPas) != rank || pos.Squares[pos.EnPas] != Empty || pos.Squares[behind] != Empty ||
+			pos.Squares[pushed] != AllPieces[pos.SideToMove^1][Pawn] {
+			return fmt.Errorf("impossible en passant square %s", PrSq(pos.EnPas))
+		}
+	}
+
+	them := pos.SideToMove ^ 1
+	if SqAttacked(pos.Pieces[AllPieces[them][King]].Msb(), pos, pos.SideToMove) {
+		return fmt.Errorf("%s is in check but not to move", sideNames[them])
+	}
+
+	return nil
+}
+
+// FEN describes the position as a FEN string.
+func (pos *BoardStruct) FEN() string {
+	var fen strings.Builder
+
+	for rank := R8; rank >= R1; rank-- {
+		empty := 0
+
+		for file := FA; file <= FH; file++ {
+			piece := pos.Squares[FR2SQ(file, rank)]
+
+			if piece == Empty {
+				empty++
+				continue
+			}
+
+			if empty > 0 {
+				fen.WriteByte(byte('0' + empty))
+				empty = 0
+			}
+
+			fen.WriteByte(PceChar[piece])
+		}
+
+		if empty > 0 {
+			fen.WriteByte(byte('0' + empty))
+		}
+
+		if rank != R1 {
+			fen.WriteByte('/')
+		}
+	}
+
+	fen.WriteByte(' ')
+	fen.WriteByte(SideChar[pos.SideToMove])
+	fen.WriteByte(' ')
+
+	castling := ""
+	for i, right := range "KQkq" {
+		if pos.CastlePerm&(1<<i) != 0 {
+			castling += string(right)
+		}
+	}
+
+	if castling == "" {
+		castling = "-"
+	}
+
+	ep := "-"
+	if pos.EnPas != NoSq {
+		ep = PrSq(pos.EnPas)
+	}
+
+	fullMove := (pos.StartPly+pos.HistoryPly)/2 + 1
+	fmt.Fprintf(&fen, "%s %s %d %d", castling, ep, pos.Rule50, fullMove)
+
+	return fen.String()
 }
 
 func (pos *BoardStruct) String() string {
@@ -492,6 +782,7 @@ func (pos *BoardStruct) String() string {
 	pos.Hash = GeneratePosKey(pos)
 
 	boardStr += fmt.Sprintf("castle:%s%s%s%s\n", castleWK, castleWQ, castleBK, castleBQ)
+	boardStr += fmt.Sprintf("Fen:%s\n", pos.FEN())
 	boardStr += fmt.Sprintf("PosKey:%d\n", pos.Hash)
 
 	return boardStr
@@ -0,0 +1,83 @@
+package engine
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseFenErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		fen  string
+		err  string
+	}{
+		{"too few fields", "4k3/8/8/8/8/8/8/4K3 w", "expected 4 to 6 fields"},
+		{"too many fields", "4k3/8/8/8/8/8/8/4K3 w - - 0 1 x", "expected 4 to 6 fields"},
+		{"missing rank", "4k3/8/8/8/8/8/4K3 w - - 0 1", "expected 8 ranks"},
+		{"short rank", "4k3/8/8/8/8/8/8/4K2 w - - 0 1", "rank 1 has 7 squares"},
+		{"long rank", "4k3/8/8/8/8/8/8/4K3p w - - 0 1", "rank 1 has more than 8 squares"},
+		{"bad piece", "4k3/8/8/8/8/8/8/4K2x w - - 0 1", "invalid character"},
+		{"missing white king", "4k3/8/8/8/8/8/8/8 w - - 0 1", "white has 0 kings"},
+		{"two black kings", "3kk3/8/8/8/8/8/8/4K3 w - - 0 1", "black has 2 kings"},
+		{"pawn on rank 8", "P3k3/8/8/8/8/8/8/4K3 w - - 0 1", "pawn on rank 8"},
+		{"pawn on rank 1", "4k3/8/8/8/8/8/8/p3K3 w - - 0 1", "pawn on rank 1"},
+		{"bad side", "4k3/8/8/8/8/8/8/4K3 x - - 0 1", "invalid side to move"},
+		{"bad castling letter", "4k3/8/8/8/8/8/8/4K3 w X - 0 1", "invalid castling rights"},
+		{"repeated castling", "r3k2r/8/8/8/8/8/8/R3K2R w KK - 0 1", "invalid castling rights"},
+		{"castling without rook", "4k3/8/8/8/8/8/8/4K3 w K - 0 1", "castling right K"},
+		{"castling with moved king", "r3k2r/8/8/8/8/8/8/R2K3R w Q - 0 1", "castling right Q"},
+		{"castling without black rook", "r3k3/8/8/8/8/8/8/4K3 w k - 0 1", "castling right k"},
+		{"malformed en passant", "4k3/8/8/8/8/8/8/4K3 w - e9 0 1", "invalid en passant square"},
+		{"en passant on wrong rank", "4k3/8/8/3p4/8/8/8/4K3 w - d5 0 1", "impossible en passant square"},
+		{"en passant without pawn", "4k3/8/8/8/8/8/8/4K3 w - d6 0 1", "impossible en passant square"},
+		{"en passant for side to move", "4k3/8/8/8/3P4/8/8/4K3 w - d3 0 1", "impossible en passant square"},
+		{"bad halfmove clock", "4k3/8/8/8/8/8/8/4K3 w - - x 1", "invalid halfmove clock"},
+		{"bad fullmove number", "4k3/8/8/8/8/8/8/4K3 w - - 0 0", "invalid fullmove number"},
+		{"side not to move in check", "4k3/8/8/8/8/8/8/4K2r b - - 0 1", "white is in check but not to move"},
+	}
+
+	for _, test := range tests {
+		var pos BoardStruct
+
+		err := pos.ParseFen(test.fen)
+		if err == nil {
+			t.Errorf("%s: ParseFen(%q) succeeded", test.name, test.fen)
+		} else if !strings.Contains(err.Error(), test.err) {
+			t.Errorf("%s: ParseFen(%q) = %q, want an error containing %q", test.name, test.fen, err, test.err)
+		}
+	}
+}
+
+func TestFENRoundTrip(t *testing.T) {
+	fens := []string{
+		"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1",
+		"r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1",
+		"rnbqkbnr/ppp1p1pp/8/3pPp2/8/8/PPPP1PPP/RNBQKBNR w KQkq f6 0 3",
+		"8/2p5/3p4/KP5r/1R3p1k/8/4P1P1/8 b - - 12 47",
+		"4k3/8/8/8/8/8/8/4K2r w - - 99 120",
+	}
+
+	for _, fen := range fens {
+		if got := mustParseFen(t, fen).FEN(); got != fen {
+			t.Errorf("FEN() = %q, want %q", got, fen)
+		}
+	}
+
+	// The counters follow the moves made after parsing.
+	pos := mustParseFen(t, FENStart)
+	for _, move := range []string{"e2e4", "e7e5", "g1f3"} {
+		pos.DoMove(ParseMove(move, pos))
+	}
+
+	if want := "rnbqkbnr/pppp1ppp/8/4p3/4P3/5N2/PPPP1PPP/RNBQKB1R b KQkq - 1 2"; pos.FEN() != want {
+		t.Errorf("FEN() after 1.e4 e5 2.Nf3 = %q, want %q", pos.FEN(), want)
+	}
+}
+
+func TestFENMissingCounters(t *testing.T) {
+	pos := mustParseFen(t, "4k3/8/8/8/8/8/8/4K3 b - -")
+
+	if want := "4k3/8/8/8/8/8/8/4K3 b - - 0 1"; pos.FEN() != want {
+		t.Errorf("FEN() = %q, want %q", pos.FEN(), want)
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"sort"
 )
 
 var ConvertToPolyPiece = [13]int{-1, 1, 3, 5, 7, 9, 11, 0, 2, 4, 6, 8, 10}
@@ -113,9 +114,9 @@ func PolyKeyFromBoard(board *BoardStruct) uint64 {
 		finalKey ^= Random64Poly[offset+3]
 	}
 
-	// enpassant
+	// enpassant, only if a pawn of the side to move can capture there
 	offset = 772
-	if board.EnPas != NoSq {
+	if board.EnPas != NoSq && PawnAttacks[board.SideToMove][board.EnPas]&board.Pieces[AllPieces[board.SideToMove][Pawn]] != 0 {
 		finalKey ^= Random64Poly[offset+FileOf(board.EnPas)]
 	}
 
@@ -126,6 +127,165 @@ func PolyKeyFromBoard(board *BoardStruct) uint64 {
 	return finalKey
 }
 
+// The statistics of a book move: how often it was played, and how often
+// the side playing it won and drew.
+type bookMoveStats struct {
+	games int
+	wins  int
+	draws int
+}
+
+// BookBuilder collects the moves played in positions to build a Polyglot
+// book from them.
+type BookBuilder struct {
+	// Moves played in fewer games are left out of the book. The count is
+	// per move, so a position played often keeps only its popular moves.
+	MinGames int
+
+	moves map[uint64]map[uint16]*bookMoveStats
+}
+
+func NewBookBuilder(minGames int) *BookBuilder {
+	return &BookBuilder{MinGames: minGames, moves: make(map[uint64]map[uint16]*bookMoveStats)}
+}
+
+// Add records the move played in the position, with the result of the game
+// for the side playing it: 1 for a win, 0.5 for a draw and 0 for a loss.
+func (builder *BookBuilder) Add(pos *BoardStruct, move Move, result float64) {
+	key := PolyKeyFromBoard(pos)
+
+	if builder.moves[key] == nil {
+		builder.moves[key] = make(map[uint16]*bookMoveStats)
+	}
+
+	polyMove := PolyMoveFromMove(move)
+	stats := builder.moves[key][polyMove]
+
+	if stats == nil {
+		stats = &bookMoveStats{}
+		builder.moves[key][polyMove] = stats
+	}
+
+	stats.games++
+
+	switch result {
+	case 1:
+		stats.wins++
+	case 0.5:
+		stats.draws++
+	}
+}
+
+// Write writes the book to the file, sorted by key and, for each key, by
+// weight. A move's weight is twice its wins plus its draws, scaled down if
+// needed to fit into 16 bits; losses only count towards the games played.
+// Moves that never scored are left out along with those played in fewer
+// than MinGames games. The number of entries written is returned.
+func (builder *BookBuilder) Write(path string) (int, error) {
+	var entries []polyBookEntry
+
+	for key, moves := range builder.moves {
+		for polyMove, stats := range moves {
+			if stats.games < builder.MinGames {
+				continue
+			}
+
+			if weight := 2*stats.wins + stats.draws; weight > 0 {
+				entries = append(entries, polyBookEntry{key, polyMove, weight})
+			}
+		}
+	}
+
+	maxWeight := 0
+	for _, entry := range entries {
+		maxWeight = max(maxWeight, entry.weight)
+	}
+
+	if maxWeight > 0xffff {
+		for i := range entries {
+			entries[i].weight = max(entries[i].weight*0xffff/maxWeight, 1)
+		}
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].key != entries[j].key {
+			return entries[i].key < entries[j].key
+		}
+		if entries[i].weight != entries[j].weight {
+			return entries[i].weight > entries[j].weight
+		}
+		return entries[i].move < entries[j].move
+	})
+
+	file, err := os.Create(path)
+	if err != nil {
+		return 0, err
+	}
+
+	writer := bufio.NewWriter(file)
+
+	for _, entry := range entries {
+		var entryBytes [16]byte
+
+		binary.BigEndian.PutUint64(entryBytes[0:8], entry.key)
+		binary.BigEndian.PutUint16(entryBytes[8:10], entry.move)
+		binary.BigEndian.PutUint16(entryBytes[10:12], uint16(entry.weight))
+
+		// The learn data stays zero.
+		writer.Write(entryBytes[:])
+	}
+
+	if err := writer.Flush(); err != nil {
+		file.Close()
+		return 0, err
+	}
+
+	return len(entries), file.Close()
+}
+
+// Polyglot books write castling as the king capturing its rook.
+var polyCastleMoves = map[string]string{"e1h1": "e1g1", "e1a1": "e1c1", "e8h8": "e8g8", "e8a8": "e8c8"}
+
+// ParseBookMove finds the legal move of the position for a move read from
+// a Polyglot book.
+func ParseBookMove(str string, pos *BoardStruct) Move {
+	if castle, ok := polyCastleMoves[str]; ok && PieceKing[pos.Squares[FR2SQ(int(str[0]-'a'), int(str[1]-'1'))]] {
+		str = castle
+	}
+
+	return ParseMove(str, pos)
+}
+
+type polyBookEntry struct {
+	key    uint64
+	move   uint16
+	weight int
+}
+
+// PolyMoveFromMove encodes the move the way Polyglot books store it.
+// Castling is written as the king capturing its rook.
+func PolyMoveFromMove(move Move) uint16 {
+	from := move.FromSq()
+	to := move.ToSq()
+
+	if move.MoveType() == Castle {
+		if FileOf(to) == FG {
+			to = FR2SQ(FH, RankOf(to))
+		} else {
+			to = FR2SQ(FA, RankOf(to))
+		}
+	}
+
+	polyMove := uint16(FileOf(to)) | uint16(RankOf(to))<<3 | uint16(FileOf(from))<<6 | uint16(RankOf(from))<<9
+
+	if move.MoveType() == Promotion {
+		// Knight to queen are 1 to 4.
+		polyMove |= uint16(move.Flag()+1) << 12
+	}
+
+	return polyMove
+}
+
 var Random64Poly [781]uint64 = [781]uint64{
 	0x9D39247E33776D41, 0x2AF7398005AAA5C7, 0x44DB015024623547, 0x9C15F73E62A76AE2,
 	0x75834465489C0C89, 0x3290AC3A203001BF, 0x0FBBAD1F61042279, 0xE83A908FF2FB60CA,
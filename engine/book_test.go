@@ -0,0 +1,137 @@
+package engine
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// The reference keys from the Polyglot book format specification.
+func TestPolyKeyFromBoard(t *testing.T) {
+	tests := []struct {
+		moves []string
+		key   uint64
+	}{
+		{nil, 0x463b96181691fc9c},
+		{[]string{"e2e4"}, 0x823c9b50fd114196},
+		{[]string{"e2e4", "d7d5"}, 0x0756b94461c50fb0},
+		{[]string{"e2e4", "d7d5", "e4e5"}, 0x662fafb965db29d4},
+		// f6 can be captured en passant, so its file is part of the key.
+		{[]string{"e2e4", "d7d5", "e4e5", "f7f5"}, 0x22a48b5a8e47ff78},
+		{[]string{"e2e4", "d7d5", "e4e5", "f7f5", "e1e2"}, 0x652a607ca3f242c1},
+		{[]string{"e2e4", "d7d5", "e4e5", "f7f5", "e1e2", "e8f7"}, 0x00fdd303c946bdd9},
+		{[]string{"a2a4", "b7b5", "h2h4", "b5b4", "c2c4"}, 0x3c8123ea7b067637},
+		{[]string{"a2a4", "b7b5", "h2h4", "b5b4", "c2c4", "b4c3", "a1a3"}, 0x5c3f9b829b279560},
+	}
+
+	for _, test := range tests {
+		pos := mustParseFen(t, FENStart)
+
+		for _, str := range test.moves {
+			move := ParseMove(str, pos)
+			if move == NoMove {
+				t.Fatalf("%v: %s isn't legal", test.moves, str)
+			}
+			pos.DoMove(move)
+		}
+
+		if key := PolyKeyFromBoard(pos); key != test.key {
+			t.Errorf("%v: key %016x, want %016x", test.moves, key, test.key)
+		}
+	}
+}
+
+func TestBookBuilderWrite(t *testing.T) {
+	builder := NewBookBuilder(2)
+
+	// Add the moves of a few short games, each played twice.
+	games := [][]string{
+		{"e2e4", "e7e5", "g1f3", "b8c6"},
+		{"d2d4", "d7d5", "c2c4", "e7e6"},
+		{"e2e4", "c7c5", "g1f3", "d7d6"},
+		{"g1f3", "g8f6", "g2g3", "g7g6", "f1g2", "f8g7", "e1g1"},
+	}
+	results := []float64{1, 0.5, 0, 1}
+
+	for i, game := range games {
+		for n := 0; n < 2; n++ {
+			pos := mustParseFen(t, FENStart)
+
+			for ply, str := range game {
+				move := ParseMove(str, pos)
+
+				score := results[i]
+				if ply%2 == 1 {
+					score = 1 - score
+				}
+
+				builder.Add(pos, move, score)
+				pos.DoMove(move)
+			}
+		}
+	}
+
+	// Played once only, so left out.
+	builder.Add(mustParseFen(t, FENStart), ParseMove("b1c3", mustParseFen(t, FENStart)), 1)
+
+	path := filepath.Join(t.TempDir(), "book.bin")
+	count, err := builder.Write(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(data) != count*16 {
+		t.Fatalf("%d bytes written for %d entries", len(data), count)
+	}
+
+	for i := 16; i < len(data); i += 16 {
+		prev := binary.BigEndian.Uint64(data[i-16:])
+		key := binary.BigEndian.Uint64(data[i:])
+
+		if key < prev {
+			t.Errorf("entry %d: key %016x after %016x", i/16, key, prev)
+		} else if key == prev && binary.BigEndian.Uint16(data[i+10:]) > binary.BigEndian.Uint16(data[i-6:]) {
+			t.Errorf("entry %d: weights of key %016x not in descending order", i/16, key)
+		}
+	}
+
+	book, err := LoadPolyglotFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := mustParseFen(t, FENStart)
+	weights := make(map[string]uint16)
+	for _, entry := range book[PolyKeyFromBoard(start)] {
+		weights[entry.Move] = entry.Weight
+	}
+
+	// e4 won twice and lost twice, d4 drew twice, Nf3 won twice, Nc3 was
+	// played too rarely.
+	want := map[string]uint16{"e2e4": 4, "d2d4": 2, "g1f3": 4}
+	if len(weights) != len(want) {
+		t.Errorf("start position moves %v, want %v", weights, want)
+	}
+	for move, weight := range want {
+		if weights[move] != weight {
+			t.Errorf("weight of %s = %d, want %d", move, weights[move], weight)
+		}
+	}
+
+	// Castling is stored as the king capturing its rook, and played as
+	// the castling move.
+	pos := mustParseFen(t, "rnbqk2r/ppppppbp/5np1/8/8/5NP1/PPPPPPBP/RNBQK2R w KQkq - 4 4")
+	entries := book[PolyKeyFromBoard(pos)]
+	if len(entries) != 1 || entries[0].Move != "e1h1" {
+		t.Fatalf("castling entries %v, want e1h1", entries)
+	}
+	if move := ParseBookMove(entries[0].Move, pos); move.String() != "e1g1" {
+		t.Errorf("ParseBookMove(e1h1) = %s, want e1g1", move)
+	}
+}
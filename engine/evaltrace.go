@@ -0,0 +1,109 @@
+package engine
+
+import (
+	"fmt"
+	"strings"
+)
+
+// The evaluation terms an EvalTrace breaks the score down into. The piece
+// square terms follow each other in piece type order, starting at TermPst.
+const (
+	TermMaterial = iota
+	TermPst
+	TermPawnStructure = TermPst + 6
+	TermPassedPawns   = TermPawnStructure + 1
+	TermMobility      = TermPassedPawns + 1
+	TermOpenFiles     = TermMobility + 1
+	TermBishopPair    = TermOpenFiles + 1
+	TermKingShelter   = TermBishopPair + 1
+	TermKingAttack    = TermKingShelter + 1
+	TermCount         = TermKingAttack + 1
+)
+
+var TermNames = [TermCount]string{
+	"Material",
+	"Pawn PST",
+	"Knight PST",
+	"Bishop PST",
+	"Rook PST",
+	"Queen PST",
+	"King PST",
+	"Pawn structure",
+	"Passed pawns",
+	"Mobility",
+	"Open files",
+	"Bishop pair",
+	"King shelter",
+	"King attack",
+}
+
+// EvalTrace collects the value of every evaluation term for both sides,
+// so it can be shown where a score comes from.
+type EvalTrace struct {
+	Terms [2][TermCount]Score
+}
+
+// Record the value of a term for the side and return it, so the call can
+// wrap the value added to the score. Does nothing on a nil trace.
+func (t *EvalTrace) add(side uint8, term int, score Score) Score {
+	if t != nil {
+		t.Terms[side][term] += score
+	}
+
+	return score
+}
+
+// TraceEval evaluates the position like EvalPosition and returns the
+// evaluation terms it was made of.
+func TraceEval(pos *BoardStruct) *EvalTrace {
+	trace := new(EvalTrace)
+
+	evalScore(pos, trace)
+
+	return trace
+}
+
+// Get a table of the terms of the evaluation, with the middlegame and
+// endgame values of each side, the difference between them and the
+// tapered value of that difference, all from White's point of view.
+func (t *EvalTrace) String(pos *BoardStruct) string {
+	var sb strings.Builder
+
+	phase := gamePhase(pos)
+	separator := strings.Repeat("-", 76) + "\n"
+
+	sb.WriteString(separator)
+	sb.WriteString(fmt.Sprintf("| %-14s |     White     |     Black     |     Total     | Tapered |\n", "Term"))
+	sb.WriteString(fmt.Sprintf("| %-14s |   MG  |   EG  |   MG  |   EG  |   MG  |   EG  |         |\n", ""))
+	sb.WriteString(separator)
+
+	var white, black Score
+
+	for term := 0; term < TermCount; term++ {
+		white += t.Terms[White][term]
+		black += t.Terms[Black][term]
+
+		sb.WriteString(traceRow(TermNames[term], t.Terms[White][term], t.Terms[Black][term], phase))
+	}
+
+	sb.WriteString(separator)
+	sb.WriteString(traceRow("Total", white, black, phase))
+	sb.WriteString(separator)
+
+	sb.WriteString(fmt.Sprintf("Phase : %d/%d\n", phase, TotalPhase))
+
+	if pos.Pieces[wPawn].CountBits() != 0 && pos.Pieces[bPawn].CountBits() != 0 && materialDraw(pos) {
+		sb.WriteString("Material draw, the evaluation is 0\n")
+	}
+
+	sb.WriteString(fmt.Sprintf("Eval  : %d (side to move)\n", EvalPosition(pos)))
+
+	return sb.String()
+}
+
+func traceRow(name string, white Score, black Score, phase int) string {
+	total := white - black
+
+	return fmt.Sprintf("| %-14s | %5d | %5d | %5d | %5d | %5d | %5d | %7d |\n",
+		name, white.MG(), white.EG(), black.MG(), black.EG(), total.MG(), total.EG(), taper(total, phase))
+}
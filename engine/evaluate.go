@@ -4,90 +4,289 @@ import (
 	"math"
 )
 
-const (
-	IsolatedPawnPenalty = -10
-	DoublePawnPenalty   = -10
-
-	RookOpenFile      = 10
-	RookSemiOpenFile  = 5
-	QueenOpenFile     = 5
-	QueenSemiOpenFile = 3
-	BishopPair        = 30
-
-	EndGameMaterialScore = 21340
-)
-
-var BlackPassedMask [64]Bitboard
-var WhitePassedMask [64]Bitboard
-var IsolatedMask [64]Bitboard
-
-var PawnPassed = [8]int{0, 5, 10, 20, 35, 60, 100, 200}
-
-var PstPawn = [64]int{
-	0, 0, 0, 0, 0, 0, 0, 0,
-	5, 10, 10, -20, -20, 10, 10, 5,
-	5, -5, -10, 0, 0, -10, -5, 5,
-	0, 0, 0, 20, 20, 0, 0, 0,
-	5, 5, 10, 25, 25, 10, 5, 5,
-	10, 10, 20, 30, 30, 20, 10, 10,
-	50, 50, 50, 50, 50, 50, 50, 50,
-	0, 0, 0, 0, 0, 0, 0, 0,
+// Score packs a middlegame and an endgame value into a single integer, so
+// scores can be added up without handling both halves separately. The
+// endgame value is kept in the upper 16 bits, the middlegame value in the
+// lower ones.
+type Score int32
+
+func S(mg int, eg int) Score {
+	return Score(int32(uint32(eg)<<16) + int32(mg))
 }
 
-var PstKnight = [64]int{
-	-50, -40, -30, -30, -30, -30, -40, -50,
-	-40, -20, 0, 5, 5, 0, -20, -40,
-	-30, 5, 10, 15, 15, 10, 5, -30,
-	-30, 0, 15, 20, 20, 15, 0, -30,
-	-30, 5, 15, 20, 20, 15, 5, -30,
-	-30, 0, 10, 15, 15, 10, 0, -30,
-	-40, -20, 0, 0, 0, 0, -20, -40,
-	-50, -40, -30, -30, -30, -30, -40, -50,
+func (s Score) MG() int {
+	return int(int16(uint16(uint32(s))))
 }
 
-var PstBishop = [64]int{
-	-20, -10, -10, -10, -10, -10, -10, -20,
-	-10, 5, 0, 0, 0, 0, 5, -10,
-	-10, 10, 10, 10, 10, 10, 10, -10,
-	-10, 0, 10, 10, 10, 10, 0, -10,
-	-10, 5, 5, 10, 10, 5, 5, -10,
-	-10, 0, 5, 10, 10, 5, 0, -10,
-	-10, 0, 0, 0, 0, 0, 0, -10,
-	-20, -10, -10, -10, -10, -10, -10, -20,
+func (s Score) EG() int {
+	return int(int16(uint16(uint32(s+0x8000) >> 16)))
 }
 
-var PstRook = [64]int{
-	0, 0, 0, 5, 5, 0, 0, 0,
-	-5, 0, 0, 0, 0, 0, 0, -5,
-	-5, 0, 0, 0, 0, 0, 0, -5,
-	-5, 0, 0, 0, 0, 0, 0, -5,
-	-5, 0, 0, 0, 0, 0, 0, -5,
-	-5, 0, 0, 0, 0, 0, 0, -5,
-	5, 10, 10, 10, 10, 10, 10,
-	5, 0, 0, 0, 0, 0, 0, 0, 0,
+// The game phase counts the non-pawn material on the board, from
+// TotalPhase with all pieces on the board down to 0 in a pawn endgame.
+const TotalPhase = 24
+
+var PhaseWeight = [7]int{0, 0, 1, 1, 2, 4, 0}
+
+// EvalWeights holds all weights of the evaluation that can be tuned and
+// loaded from a parameter file, see EvalParams.
+type EvalWeights struct {
+	// The material value of each piece type.
+	PieceScore [7]Score
+
+	IsolatedPawnPenalty Score
+	DoublePawnPenalty   Score
+	BackwardPawnPenalty Score
+
+	// The bonuses of pawns defended by a pawn, pawns with a pawn next to
+	// them, pawns that can become passed and passed pawns, indexed by the
+	// rank of the pawn from its own side.
+	PawnConnected [8]Score
+	PawnPhalanx   [8]Score
+	PawnCandidate [8]Score
+	PawnPassed    [8]Score
+
+	// The bonus per square of distance between a passed pawn's stop
+	// square and the own and the enemy king, and the bonus for a passed
+	// pawn whose path to promotion is free, indexed by its rank.
+	PassedOwnKingDistance   [8]Score
+	PassedEnemyKingDistance [8]Score
+	PassedFreePath          [8]Score
+
+	// The bonus per square a piece can move to, after subtracting the
+	// number of squares it has on average.
+	Mobility [7]Score
+
+	RookOpenFile      Score
+	RookSemiOpenFile  Score
+	QueenOpenFile     Score
+	QueenSemiOpenFile Score
+	BishopPair        Score
+
+	// King safety. The pawn shield bonus and the pawn storm penalty are
+	// indexed by how many ranks in front of the king the pawn is.
+	PawnShield [4]Score
+	PawnStorm  [5]Score
+
+	KingOpenFile     Score
+	KingSemiOpenFile Score
+
+	// The bonus for the attack units on the enemy king zone, see
+	// KingAttackWeight.
+	KingAttackTable [100]int
+
+	// The piece square tables, from White's point of view with A1 first.
+	PstPawnMG   [64]int
+	PstPawnEG   [64]int
+	PstKnightMG [64]int
+	PstKnightEG [64]int
+	PstBishopMG [64]int
+	PstBishopEG [64]int
+	PstRookMG   [64]int
+	PstRookEG   [64]int
+	PstQueenMG  [64]int
+	PstQueenEG  [64]int
+	PstKingMG   [64]int
+	PstKingEG   [64]int
 }
 
-var PstKingMG = [64]int{
-	20, 30, 10, 0, 0, 10, 30, 20,
-	20, 20, 0, 0, 0, 0, 20, 20,
-	-10, -20, -20, -20, -20, -20, -20, -10,
-	-20, -30, -30, -40, -40, -30, -30, -20,
-	-30, -40, -40, -50, -50, -40, -40, -30,
-	-30, -40, -40, -50, -50, -40, -40, -30,
-	-30, -40, -40, -50, -50, -40, -40, -30,
-	-30, -40, -40, -50, -50, -40, -40, -30,
+// The built-in evaluation weights.
+var DefaultWeights = EvalWeights{
+	PieceScore: [7]Score{S(0, 0), S(100, 120), S(320, 300), S(330, 320), S(500, 540), S(900, 960), S(0, 0)},
+
+	IsolatedPawnPenalty: S(-10, -15),
+	DoublePawnPenalty:   S(-10, -20),
+	BackwardPawnPenalty: S(-8, -10),
+
+	PawnConnected: [8]Score{S(0, 0), S(0, 0), S(8, 4), S(10, 6), S(15, 12), S(25, 25), S(40, 50), S(0, 0)},
+	PawnPhalanx:   [8]Score{S(0, 0), S(2, 0), S(4, 2), S(6, 4), S(12, 10), S(25, 25), S(40, 40), S(0, 0)},
+	PawnCandidate: [8]Score{S(0, 0), S(0, 5), S(3, 8), S(6, 12), S(10, 20), S(15, 35), S(0, 0), S(0, 0)},
+	PawnPassed:    [8]Score{S(0, 0), S(0, 10), S(5, 15), S(10, 25), S(20, 45), S(35, 80), S(60, 130), S(0, 0)},
+
+	PassedOwnKingDistance:   [8]Score{S(0, 0), S(0, 0), S(0, 0), S(0, -2), S(0, -5), S(0, -8), S(0, -10), S(0, 0)},
+	PassedEnemyKingDistance: [8]Score{S(0, 0), S(0, 0), S(0, 0), S(0, 5), S(0, 10), S(0, 15), S(0, 20), S(0, 0)},
+	PassedFreePath:          [8]Score{S(0, 0), S(0, 0), S(0, 5), S(0, 10), S(0, 15), S(5, 25), S(10, 40), S(0, 0)},
+
+	Mobility: [7]Score{S(0, 0), S(0, 0), S(4, 4), S(5, 5), S(2, 4), S(1, 2), S(0, 0)},
+
+	RookOpenFile:      S(20, 10),
+	RookSemiOpenFile:  S(10, 5),
+	QueenOpenFile:     S(5, 5),
+	QueenSemiOpenFile: S(3, 3),
+	BishopPair:        S(30, 50),
+
+	PawnShield: [4]Score{S(0, 0), S(15, 0), S(8, 0), S(2, 0)},
+	PawnStorm:  [5]Score{S(0, 0), S(-5, 0), S(-25, -5), S(-15, 0), S(-5, 0)},
+
+	KingOpenFile:     S(-25, 0),
+	KingSemiOpenFile: S(-12, 0),
+
+	KingAttackTable: [100]int{
+		0, 0, 1, 1, 3, 4, 6, 8, 10, 13,
+		16, 19, 23, 27, 31, 36, 41, 46, 52, 58,
+		64, 71, 77, 85, 92, 100, 108, 117, 125, 135,
+		144, 154, 164, 174, 185, 196, 207, 219, 231, 243,
+		256, 269, 282, 296, 310, 324, 339, 353, 369, 384,
+		400, 416, 433, 449, 467, 484, 500, 500, 500, 500,
+		500, 500, 500, 500, 500, 500, 500, 500, 500, 500,
+		500, 500, 500, 500, 500, 500, 500, 500, 500, 500,
+		500, 500, 500, 500, 500, 500, 500, 500, 500, 500,
+		500, 500, 500, 500, 500, 500, 500, 500, 500, 500,
+	},
+
+	PstPawnMG: [64]int{
+		0, 0, 0, 0, 0, 0, 0, 0,
+		5, 10, 10, -20, -20, 10, 10, 5,
+		5, -5, -10, 0, 0, -10, -5, 5,
+		0, 0, 0, 20, 20, 0, 0, 0,
+		5, 5, 10, 25, 25, 10, 5, 5,
+		10, 10, 20, 30, 30, 20, 10, 10,
+		50, 50, 50, 50, 50, 50, 50, 50,
+		0, 0, 0, 0, 0, 0, 0, 0,
+	},
+
+	PstPawnEG: [64]int{
+		0, 0, 0, 0, 0, 0, 0, 0,
+		5, 5, 5, 5, 5, 5, 5, 5,
+		5, 5, 5, 5, 5, 5, 5, 5,
+		10, 10, 10, 10, 10, 10, 10, 10,
+		20, 20, 20, 20, 20, 20, 20, 20,
+		40, 40, 40, 40, 40, 40, 40, 40,
+		80, 80, 80, 80, 80, 80, 80, 80,
+		0, 0, 0, 0, 0, 0, 0, 0,
+	},
+
+	PstKnightMG: [64]int{
+		-50, -40, -30, -30, -30, -30, -40, -50,
+		-40, -20, 0, 5, 5, 0, -20, -40,
+		-30, 5, 10, 15, 15, 10, 5, -30,
+		-30, 0, 15, 20, 20, 15, 0, -30,
+		-30, 5, 15, 20, 20, 15, 5, -30,
+		-30, 0, 10, 15, 15, 10, 0, -30,
+		-40, -20, 0, 0, 0, 0, -20, -40,
+		-50, -40, -30, -30, -30, -30, -40, -50,
+	},
+
+	PstKnightEG: [64]int{
+		-40, -30, -20, -20, -20, -20, -30, -40,
+		-30, -15, -5, 0, 0, -5, -15, -30,
+		-20, -5, 5, 10, 10, 5, -5, -20,
+		-20, 0, 10, 15, 15, 10, 0, -20,
+		-20, 0, 10, 15, 15, 10, 0, -20,
+		-20, -5, 5, 10, 10, 5, -5, -20,
+		-30, -15, -5, 0, 0, -5, -15, -30,
+		-40, -30, -20, -20, -20, -20, -30, -40,
+	},
+
+	PstBishopMG: [64]int{
+		-20, -10, -10, -10, -10, -10, -10, -20,
+		-10, 5, 0, 0, 0, 0, 5, -10,
+		-10, 10, 10, 10, 10, 10, 10, -10,
+		-10, 0, 10, 10, 10, 10, 0, -10,
+		-10, 5, 5, 10, 10, 5, 5, -10,
+		-10, 0, 5, 10, 10, 5, 0, -10,
+		-10, 0, 0, 0, 0, 0, 0, -10,
+		-20, -10, -10, -10, -10, -10, -10, -20,
+	},
+
+	PstBishopEG: [64]int{
+		-15, -10, -10, -5, -5, -10, -10, -15,
+		-10, -5, 0, 0, 0, 0, -5, -10,
+		-10, 0, 5, 5, 5, 5, 0, -10,
+		-5, 0, 5, 10, 10, 5, 0, -5,
+		-5, 0, 5, 10, 10, 5, 0, -5,
+		-10, 0, 5, 5, 5, 5, 0, -10,
+		-10, -5, 0, 0, 0, 0, -5, -10,
+		-15, -10, -10, -5, -5, -10, -10, -15,
+	},
+
+	PstRookMG: [64]int{
+		0, 0, 0, 5, 5, 0, 0, 0,
+		-5, 0, 0, 0, 0, 0, 0, -5,
+		-5, 0, 0, 0, 0, 0, 0, -5,
+		-5, 0, 0, 0, 0, 0, 0, -5,
+		-5, 0, 0, 0, 0, 0, 0, -5,
+		-5, 0, 0, 0, 0, 0, 0, -5,
+		5, 10, 10, 10, 10, 10, 10, 5,
+		0, 0, 0, 0, 0, 0, 0, 0,
+	},
+
+	PstRookEG: [64]int{
+		0, 0, 0, 0, 0, 0, 0, 0,
+		0, 0, 0, 0, 0, 0, 0, 0,
+		0, 0, 0, 0, 0, 0, 0, 0,
+		0, 0, 0, 0, 0, 0, 0, 0,
+		0, 0, 0, 0, 0, 0, 0, 0,
+		0, 0, 0, 0, 0, 0, 0, 0,
+		10, 10, 10, 10, 10, 10, 10, 10,
+		5, 5, 5, 5, 5, 5, 5, 5,
+	},
+
+	PstQueenMG: [64]int{
+		-20, -10, -10, -5, -5, -10, -10, -20,
+		-10, 0, 5, 0, 0, 0, 0, -10,
+		-10, 5, 5, 5, 5, 5, 0, -10,
+		0, 0, 5, 5, 5, 5, 0, -5,
+		-5, 0, 5, 5, 5, 5, 0, -5,
+		-10, 0, 5, 5, 5, 5, 0, -10,
+		-10, 0, 0, 0, 0, 0, 0, -10,
+		-20, -10, -10, -5, -5, -10, -10, -20,
+	},
+
+	PstQueenEG: [64]int{
+		-30, -20, -10, -10, -10, -10, -20, -30,
+		-20, -10, 0, 5, 5, 0, -10, -20,
+		-10, 0, 10, 15, 15, 10, 0, -10,
+		-10, 5, 15, 20, 20, 15, 5, -10,
+		-10, 5, 15, 20, 20, 15, 5, -10,
+		-10, 0, 10, 15, 15, 10, 0, -10,
+		-20, -10, 0, 5, 5, 0, -10, -20,
+		-30, -20, -10, -10, -10, -10, -20, -30,
+	},
+
+	PstKingMG: [64]int{
+		20, 30, 10, 0, 0, 10, 30, 20,
+		20, 20, 0, 0, 0, 0, 20, 20,
+		-10, -20, -20, -20, -20, -20, -20, -10,
+		-20, -30, -30, -40, -40, -30, -30, -20,
+		-30, -40, -40, -50, -50, -40, -40, -30,
+		-30, -40, -40, -50, -50, -40, -40, -30,
+		-30, -40, -40, -50, -50, -40, -40, -30,
+		-30, -40, -40, -50, -50, -40, -40, -30,
+	},
+
+	PstKingEG: [64]int{
+		-50, -30, -30, -30, -30, -30, -30, -50,
+		-30, -30, 0, 0, 0, 0, -30, -30,
+		-30, -10, 20, 30, 30, 20, -10, -30,
+		-30, -10, 30, 40, 40, 30, -10, -30,
+		-30, -10, 30, 40, 40, 30, -10, -30,
+		-30, -10, 20, 30, 30, 20, -10, -30,
+		-30, -20, -10, 0, 0, -10, -20, -30,
+		-50, -40, -30, -20, -20, -30, -40, -50,
+	},
 }
 
-var PstKingEG = [64]int{
-	-50, -30, -30, -30, -30, -30, -30, -50,
-	-30, -30, 0, 0, 0, 0, -30, -30,
-	-30, -10, 20, 30, 30, 20, -10, -30,
-	-30, -10, 30, 40, 40, 30, -10, -30,
-	-30, -10, 30, 40, 40, 30, -10, -30,
-	-30, -10, 20, 30, 30, 20, -10, -30,
-	-30, -20, -10, 0, 0, -10, -20, -30,
-	-50, -40, -30, -20, -20, -30, -40, -50,
-}
+// The weights used by the evaluation. These are DefaultWeights unless a
+// parameter file was loaded.
+var Weights = DefaultWeights
+
+// The attack units a piece adds for each square of the enemy king zone it
+// attacks. The sum is turned into a bonus by KingAttackTable, which grows
+// faster than the number of attackers, since an attack with several
+// pieces is much more dangerous than a single piece near the king.
+var KingAttackWeight = [7]int{0, 0, 2, 2, 3, 5, 0}
+
+var MobilityBase = [7]int{0, 0, 4, 7, 7, 14, 0}
+
+var BlackPassedMask [64]Bitboard
+var WhitePassedMask [64]Bitboard
+var IsolatedMask [64]Bitboard
+
+// The material and piece square value of every piece on every square,
+// from the piece's own point of view. Built from the tables above by
+// InitEvalMasks.
+var PieceSquareScore [13][64]Score
 
 var PieceVal = [13]int{0, 100, 320, 330, 500, 900, 20_000, 100, 320, 330, 500, 900, 20_000}
 
@@ -144,125 +343,260 @@ func InitEvalMasks() {
 			}
 		}
 	}
+
+	initPieceSquareScores()
 }
 
-func EvalPosition(pos *BoardStruct) int {
-	whiteMaterial := getMaterial(pos, White)
-	blackMaterial := getMaterial(pos, Black)
+func initPieceSquareScores() {
+	pst := [7][2]*[64]int{
+		Pawn:   {&Weights.PstPawnMG, &Weights.PstPawnEG},
+		Knight: {&Weights.PstKnightMG, &Weights.PstKnightEG},
+		Bishop: {&Weights.PstBishopMG, &Weights.PstBishopEG},
+		Rook:   {&Weights.PstRookMG, &Weights.PstRookEG},
+		Queen:  {&Weights.PstQueenMG, &Weights.PstQueenEG},
+		King:   {&Weights.PstKingMG, &Weights.PstKingEG},
+	}
+
+	for pieceType := Pawn; pieceType <= King; pieceType++ {
+		for sq := 0; sq < 64; sq++ {
+			score := Weights.PieceScore[pieceType] + S(pst[pieceType][0][sq], pst[pieceType][1][sq])
+
+			PieceSquareScore[AllPieces[White][pieceType]][sq] = score
+			PieceSquareScore[AllPieces[Black][pieceType]][Mirror(sq)] = score
+		}
+	}
+}
+
+// Get the game phase of the position, between 0 and TotalPhase.
+func gamePhase(pos *BoardStruct) int {
+	phase := 0
+
+	for pieceType := Knight; pieceType <= Queen; pieceType++ {
+		count := pos.Pieces[AllPieces[White][pieceType]].CountBits() + pos.Pieces[AllPieces[Black][pieceType]].CountBits()
+		phase += count * PhaseWeight[pieceType]
+	}
+
+	return min(phase, TotalPhase)
+}
 
-	score := whiteMaterial - blackMaterial
+// Blend the middlegame and endgame values of the score by the game phase.
+func taper(score Score, phase int) int {
+	return (score.MG()*phase + score.EG()*(TotalPhase-phase)) / TotalPhase
+}
+
+// Evaluator is an evaluation the search can use.
+type Evaluator interface {
+	// Set up what the evaluator keeps in the position, before the
+	// position is searched.
+	Init(pos *BoardStruct)
+
+	// Get the score of the position from the point of view of the side
+	// to move.
+	Evaluate(pos *BoardStruct) int
+}
+
+// ClassicalEvaluator evaluates positions with the hand-crafted evaluation.
+type ClassicalEvaluator struct{}
 
+func (ClassicalEvaluator) Init(pos *BoardStruct) {
+	pos.Net = nil
+}
+
+func (ClassicalEvaluator) Evaluate(pos *BoardStruct) int {
+	return EvalPosition(pos)
+}
+
+func EvalPosition(pos *BoardStruct) int {
 	if pos.Pieces[wPawn].CountBits() != 0 && pos.Pieces[bPawn].CountBits() != 0 && materialDraw(pos) {
 		return 0
 	}
 
-	for piece := wPawn; piece <= bKing; piece++ {
+	eval := taper(evalScore(pos, nil), gamePhase(pos))
+
+	if pos.SideToMove == White {
+		return eval
+	} else {
+		return -eval
+	}
+}
+
+// Get the untapered score of the position from White's point of view. If
+// trace isn't nil, every term is recorded in it as well, and the pawn
+// structure is evaluated without the pawn hash table.
+func evalScore(pos *BoardStruct, trace *EvalTrace) Score {
+	pawns := probePawnStructure(pos, trace)
+
+	score := evalSide(pos, White, trace) - evalSide(pos, Black, trace)
+	score += pawns.Score
+	score += evalPassedPawns(pos, White, pawns.Passed[White], trace) - evalPassedPawns(pos, Black, pawns.Passed[Black], trace)
+
+	return score
+}
+
+// Sum up the evaluation terms of one side's pieces, apart from the pawn
+// structure. If trace isn't nil, every term is recorded in it as well.
+func evalSide(pos *BoardStruct, side uint8, trace *EvalTrace) Score {
+	score := S(0, 0)
+
+	them := side ^ 1
+	ownPawns := pos.Pawns[side]
+	occupied := pos.Sides[Both]
+
+	enemyKingSq := pos.Pieces[AllPieces[them][King]].Msb()
+	kingAttack := kingAttack{zone: KingAttacks[enemyKingSq] | SetMask[enemyKingSq]}
+
+	for pieceType := Pawn; pieceType <= King; pieceType++ {
+		piece := AllPieces[side][pieceType]
 		pieceBB := pos.Pieces[piece]
 
 		for pieceBB != 0 {
 			sq := pieceBB.PopBit()
+			file := FileOf(sq)
 
-			switch piece {
-			case wPawn:
-				score += PstPawn[sq]
+			score += PieceSquareScore[piece][sq]
 
-				if (IsolatedMask[sq] & pos.Pawns[White]) == 0 {
-					score += IsolatedPawnPenalty
-				}
+			if trace != nil {
+				trace.add(side, TermMaterial, Weights.PieceScore[pieceType])
+				trace.add(side, TermPst+int(pieceType-Pawn), PieceSquareScore[piece][sq]-Weights.PieceScore[pieceType])
+			}
 
-				if (FileBBMask[FileOf(sq)] & pos.Pawns[White]).CountBits() >= 2 {
-					score += DoublePawnPenalty
+			switch pieceType {
+			case Knight:
+				attacks := KnightAttacks[sq]
+				kingAttack.add(Knight, attacks)
+
+				moves := attacks & ^pos.Sides[side]
+				score += trace.add(side, TermMobility, Weights.Mobility[Knight]*Score(moves.CountBits()-MobilityBase[Knight]))
+			case Bishop:
+				attacks := genBishopMoves(sq, occupied)
+				kingAttack.add(Bishop, attacks)
+
+				moves := attacks & ^pos.Sides[side]
+				score += trace.add(side, TermMobility, Weights.Mobility[Bishop]*Score(moves.CountBits()-MobilityBase[Bishop]))
+			case Rook:
+				attacks := genRookMoves(sq, occupied)
+				kingAttack.add(Rook, attacks)
+
+				moves := attacks & ^pos.Sides[side]
+				score += trace.add(side, TermMobility, Weights.Mobility[Rook]*Score(moves.CountBits()-MobilityBase[Rook]))
+
+				if (pos.Pawns[Both] & FileBBMask[file]) == 0 {
+					score += trace.add(side, TermOpenFiles, Weights.RookOpenFile)
+				} else if (ownPawns & FileBBMask[file]) == 0 {
+					score += trace.add(side, TermOpenFiles, Weights.RookSemiOpenFile)
 				}
+			case Queen:
+				attacks := genBishopMoves(sq, occupied) | genRookMoves(sq, occupied)
+				kingAttack.add(Queen, attacks)
 
-				if (WhitePassedMask[sq] & pos.Pawns[Black]) == 0 {
-					score += PawnPassed[RankOf(sq)]
-				}
-			case bPawn:
-				score -= PstPawn[Mirror(sq)]
+				moves := attacks & ^pos.Sides[side]
+				score += trace.add(side, TermMobility, Weights.Mobility[Queen]*Score(moves.CountBits()-MobilityBase[Queen]))
 
-				if (IsolatedMask[sq] & pos.Pawns[Black]) == 0 {
-					score -= IsolatedPawnPenalty
+				if (pos.Pawns[Both] & FileBBMask[file]) == 0 {
+					score += trace.add(side, TermOpenFiles, Weights.QueenOpenFile)
+				} else if (ownPawns & FileBBMask[file]) == 0 {
+					score += trace.add(side, TermOpenFiles, Weights.QueenSemiOpenFile)
 				}
+			case King:
+				score += trace.add(side, TermKingShelter, evalKingShelter(pos, side, sq))
+			}
+		}
+	}
 
-				if (FileBBMask[FileOf(sq)] & pos.Pawns[Black]).CountBits() >= 2 {
-					score -= DoublePawnPenalty
-				}
+	if pos.Pieces[AllPieces[side][Bishop]].CountBits() >= 2 {
+		score += trace.add(side, TermBishopPair, Weights.BishopPair)
+	}
 
-				if (BlackPassedMask[sq] & pos.Pawns[White]) == 0 {
-					score -= PawnPassed[7-RankOf(sq)]
-				}
-			case wKnight:
-				moves := KnightAttacks[sq] & ^pos.Sides[White]
-				score += PstKnight[sq]
-				score += moves.CountBits() / 2
-			case bKnight:
-				moves := KnightAttacks[sq] & ^pos.Sides[Black]
-				score -= PstKnight[Mirror(sq)]
-				score -= moves.CountBits() / 2
-			case wBishop:
-				moves := genBishopMoves(sq, pos.Sides[Both]) & ^pos.Sides[White]
-				score += PstBishop[sq]
-				score += moves.CountBits() / 2
-			case bBishop:
-				moves := genBishopMoves(sq, pos.Sides[Both]) & ^pos.Sides[Black]
-				score -= PstBishop[Mirror(sq)]
-				score -= moves.CountBits() / 2
-			case wRook:
-				score += PstRook[sq]
-
-				if (pos.Pawns[Both] & FileBBMask[FileOf(sq)]) == 0 {
-					score += RookOpenFile
-				} else if (pos.Pawns[White] & FileBBMask[FileOf(sq)]) == 0 {
-					score += RookSemiOpenFile
-				}
-			case bRook:
-				score -= PstRook[Mirror(sq)]
+	score += trace.add(side, TermKingAttack, kingAttack.score())
 
-				if (pos.Pawns[Both] & FileBBMask[FileOf(sq)]) == 0 {
-					score -= RookOpenFile
-				} else if (pos.Pawns[Black] & FileBBMask[FileOf(sq)]) == 0 {
-					score -= RookSemiOpenFile
-				}
-			case wQueen:
-				if (pos.Pawns[Both] & FileBBMask[FileOf(sq)]) == 0 {
-					score += QueenOpenFile
-				} else if (pos.Pawns[White] & FileBBMask[FileOf(sq)]) == 0 {
-					score += QueenSemiOpenFile
-				}
-			case bQueen:
-				if (pos.Pawns[Both] & FileBBMask[FileOf(sq)]) == 0 {
-					score -= QueenOpenFile
-				} else if (pos.Pawns[Black] & FileBBMask[FileOf(sq)]) == 0 {
-					score -= QueenSemiOpenFile
-				}
-			case wKing:
-				if blackMaterial <= EndGameMaterialScore {
-					score += PstKingEG[sq]
-				} else {
-					score += PstKingMG[sq]
-				}
-			case bKing:
-				if whiteMaterial <= EndGameMaterialScore {
-					score -= PstKingEG[Mirror(sq)]
-				} else {
-					score -= PstKingMG[Mirror(sq)]
-				}
+	return score
+}
+
+// The pieces of a side attacking the squares around the enemy king.
+type kingAttack struct {
+	zone      Bitboard
+	attackers int
+	units     int
+}
+
+func (ka *kingAttack) add(pieceType uint8, attacks Bitboard) {
+	hits := attacks & ka.zone
+
+	if hits != 0 {
+		ka.attackers++
+		ka.units += KingAttackWeight[pieceType] * hits.CountBits()
+	}
+}
+
+// A single piece can't mount a real attack on its own, so the attack only
+// counts with at least two attackers. It matters little in the endgame,
+// where the king becomes an active piece itself.
+func (ka *kingAttack) score() Score {
+	if ka.attackers < 2 {
+		return S(0, 0)
+	}
+
+	return S(Weights.KingAttackTable[min(ka.units, len(Weights.KingAttackTable)-1)], 0)
+}
+
+// Evaluate the pawn cover of the king on its own and the two neighbouring
+// files: the own pawns in front of it, the enemy pawns storming towards it
+// and the files lacking pawns that open lines against it.
+func evalKingShelter(pos *BoardStruct, side uint8, kingSq int) Score {
+	score := S(0, 0)
+
+	kingRank := relativeRank(side, kingSq)
+	centerFile := min(max(FileOf(kingSq), FB), FG)
+
+	for file := centerFile - 1; file <= centerFile+1; file++ {
+		fileMask := FileBBMask[file]
+		ahead := fileMask & forwardRanks(side, kingSq)
+
+		if shield := pos.Pawns[side] & ahead; shield != 0 {
+			distance := relativeRank(side, closestSquare(side, shield)) - kingRank
+			score += Weights.PawnShield[min(distance, len(Weights.PawnShield)-1)]
+		} else if pos.Pawns[side]&fileMask == 0 {
+			if pos.Pawns[Both]&fileMask == 0 {
+				score += Weights.KingOpenFile
+			} else {
+				score += Weights.KingSemiOpenFile
 			}
 		}
+
+		if storm := pos.Pawns[side^1] & ahead; storm != 0 {
+			distance := relativeRank(side, closestSquare(side, storm)) - kingRank
+			score += Weights.PawnStorm[min(distance, len(Weights.PawnStorm)-1)]
+		}
 	}
 
-	if pos.Pieces[wBishop].CountBits() >= 2 {
-		score += BishopPair
+	return score
+}
+
+// Get the rank of the square as seen from the side's own end of the board.
+func relativeRank(side uint8, sq int) int {
+	if side == Black {
+		return 7 - RankOf(sq)
 	}
-	if pos.Pieces[bBishop].CountBits() >= 2 {
-		score -= BishopPair
+
+	return RankOf(sq)
+}
+
+// Get the ranks in front of the square, seen from the side.
+func forwardRanks(side uint8, sq int) Bitboard {
+	if side == Black {
+		return FullBB >> (8 * (8 - RankOf(sq)))
 	}
 
-	if pos.SideToMove == White {
-		return score
-	} else {
-		return -score
+	return FullBB << (8 * (RankOf(sq) + 1))
+}
+
+// Get the square of the bitboard closest to the side's own end.
+func closestSquare(side uint8, bb Bitboard) int {
+	if side == Black {
+		return bb.HighestBit()
 	}
+
+	return bb.Msb()
 }
 
 func materialDraw(pos *BoardStruct) bool {
@@ -57,3 +57,16 @@ func GeneratePosKey(pos *BoardStruct) uint64 {
 
 	return finalKey
 }
+
+// Get the hash of the pawns of the position.
+func GeneratePawnKey(pos *BoardStruct) uint64 {
+	var finalKey uint64
+
+	for sq := 0; sq < 64; sq++ {
+		if piece := pos.Squares[sq]; PiecePawn[piece] {
+			finalKey ^= PieceKeys[piece][sq]
+		}
+	}
+
+	return finalKey
+}
@@ -0,0 +1,138 @@
+package engine
+
+const (
+	// The bound of every history score. Updates pull entries towards the
+	// bound they approach less the closer they are to it (history
+	// gravity), so the tables never saturate and old scores fade out.
+	MaxHistory = 16384
+
+	// The largest bonus a single cutoff adds to a history entry.
+	MaxHistoryBonus = 1536
+)
+
+// A move made on the path to the current node, and the piece making it.
+type stackEntry struct {
+	move  Move
+	piece uint8
+}
+
+// Heuristics holds the quiet move ordering tables of a search thread. They
+// are indexed by the moving piece and its target square.
+type Heuristics struct {
+	Killers [2][MaxDepth]Move
+
+	History [13][64]int16
+
+	// The quiet move that refuted a move last time, indexed by the piece
+	// and target square of the move being refuted.
+	CounterMoves [13][64]Move
+
+	// How well a quiet move did when played after a certain move one or
+	// two plies earlier, indexed by that earlier move first.
+	Continuation [13][64][13][64]int16
+
+	stack [MaxDepth + 1]stackEntry
+}
+
+func (heur *Heuristics) Clear() {
+	*heur = Heuristics{}
+}
+
+// Record the move played at the ply, NoMove for a null move.
+func (heur *Heuristics) Push(ply int, move Move, piece uint8) {
+	heur.stack[ply] = stackEntry{move: move, piece: piece}
+}
+
+// Get the move played the given number of plies before the current node.
+func (heur *Heuristics) prevMove(ply int, back int) stackEntry {
+	if ply < back {
+		return stackEntry{}
+	}
+
+	return heur.stack[ply-back]
+}
+
+func (heur *Heuristics) IsKiller(ply int, move Move) bool {
+	return heur.Killers[0][ply].Equal(move) || heur.Killers[1][ply].Equal(move)
+}
+
+// Get the counter move to the previous move, or NoMove.
+func (heur *Heuristics) CounterMove(ply int) Move {
+	prev := heur.prevMove(ply, 1)
+
+	if prev.piece == Empty {
+		return NoMove
+	}
+
+	return heur.CounterMoves[prev.piece][prev.move.ToSq()]
+}
+
+// QuietScore sums the history and both continuation histories of a quiet
+// move, as a single measure of how good it was so far.
+func (heur *Heuristics) QuietScore(pos *BoardStruct, move Move) int {
+	piece := pos.Squares[move.FromSq()]
+	to := move.ToSq()
+
+	score := int(heur.History[piece][to])
+
+	for back := 1; back <= 2; back++ {
+		if prev := heur.prevMove(pos.Ply, back); prev.piece != Empty {
+			score += int(heur.Continuation[prev.piece][prev.move.ToSq()][piece][to])
+		}
+	}
+
+	return score
+}
+
+// UpdateQuiet rewards the quiet move causing a beta cutoff, and penalizes
+// the quiet moves searched before it without success.
+func (heur *Heuristics) UpdateQuiet(pos *BoardStruct, best Move, tried []Move, depth int) {
+	ply := pos.Ply
+
+	if !heur.Killers[0][ply].Equal(best) {
+		heur.Killers[1][ply] = heur.Killers[0][ply]
+		heur.Killers[0][ply] = best
+	}
+
+	if prev := heur.prevMove(ply, 1); prev.piece != Empty {
+		heur.CounterMoves[prev.piece][prev.move.ToSq()] = best
+	}
+
+	bonus := min(32*depth*depth, MaxHistoryBonus)
+
+	heur.updateMove(pos, best, bonus)
+
+	for _, move := range tried {
+		if !move.Equal(best) {
+			heur.updateMove(pos, move, -bonus)
+		}
+	}
+}
+
+func (heur *Heuristics) updateMove(pos *BoardStruct, move Move, bonus int) {
+	piece := pos.Squares[move.FromSq()]
+	to := move.ToSq()
+
+	applyGravity(&heur.History[piece][to], bonus)
+
+	for back := 1; back <= 2; back++ {
+		if prev := heur.prevMove(pos.Ply, back); prev.piece != Empty {
+			applyGravity(&heur.Continuation[prev.piece][prev.move.ToSq()][piece][to], bonus)
+		}
+	}
+}
+
+func applyGravity(entry *int16, bonus int) {
+	value := int(*entry)
+	value += bonus - value*abs(bonus)/MaxHistory
+
+	*entry = int16(value)
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+
+	return x
+}
@@ -0,0 +1,107 @@
+package engine
+
+import "testing"
+
+func TestApplyGravity(t *testing.T) {
+	tests := []struct {
+		value int16
+		bonus int
+		want  int16
+	}{
+		{0, 512, 512},
+		{0, -512, -512},
+		{1536, 1536, 2928},
+		{-1536, -1536, -2928},
+		{8192, 1536, 8960},
+		{8192, -1536, 5888},
+		{-8192, 1536, -5888},
+		{MaxHistory, MaxHistoryBonus, MaxHistory},
+		{-MaxHistory, -MaxHistoryBonus, -MaxHistory},
+	}
+
+	for _, test := range tests {
+		value := test.value
+		applyGravity(&value, test.bonus)
+
+		if value != test.want {
+			t.Errorf("applyGravity(%d, %d) = %d, want %d", test.value, test.bonus, value, test.want)
+		}
+	}
+
+	// However often a move is rewarded or penalized, it stays in bounds.
+	high, low := int16(0), int16(0)
+	for i := 0; i < 10000; i++ {
+		applyGravity(&high, MaxHistoryBonus)
+		applyGravity(&low, -MaxHistoryBonus)
+	}
+
+	if high > MaxHistory || high < MaxHistory-MaxHistoryBonus || low < -MaxHistory || low > -MaxHistory+MaxHistoryBonus {
+		t.Errorf("saturated history scores %d and %d, want close to ±%d", high, low, MaxHistory)
+	}
+}
+
+func TestUpdateQuiet(t *testing.T) {
+	pos := mustParseFen(t, FENStart)
+	var heur Heuristics
+
+	for ply, str := range []string{"e2e4", "e7e5"} {
+		move := ParseMove(str, pos)
+		heur.Push(ply, move, pos.Squares[move.FromSq()])
+		pos.DoMove(move)
+	}
+
+	nf3 := ParseMove("g1f3", pos)
+	bc4 := ParseMove("f1c4", pos)
+	a3 := ParseMove("a2a3", pos)
+
+	heur.UpdateQuiet(pos, nf3, []Move{a3, nf3}, 4)
+
+	tests := []struct {
+		name  string
+		value int
+		want  int
+	}{
+		{"history of the best move", int(heur.History[wKnight][F3]), 512},
+		{"history of a tried move", int(heur.History[wPawn][A3]), -512},
+		{"continuation after the last move", int(heur.Continuation[bPawn][E5][wKnight][F3]), 512},
+		{"continuation after the move before", int(heur.Continuation[wPawn][E4][wKnight][F3]), 512},
+		{"continuation of a tried move", int(heur.Continuation[bPawn][E5][wPawn][A3]), -512},
+		{"quiet score of the best move", heur.QuietScore(pos, nf3), 1536},
+		{"quiet score of a tried move", heur.QuietScore(pos, a3), -1536},
+		{"quiet score of another move", heur.QuietScore(pos, bc4), 0},
+	}
+
+	for _, test := range tests {
+		if test.value != test.want {
+			t.Errorf("%s = %d, want %d", test.name, test.value, test.want)
+		}
+	}
+
+	if !heur.CounterMove(pos.Ply).Equal(nf3) {
+		t.Errorf("counter move %v, want %v", heur.CounterMove(pos.Ply), nf3)
+	}
+
+	// A new killer pushes the old one into the second slot, the same
+	// killer again doesn't fill both.
+	heur.UpdateQuiet(pos, bc4, nil, 2)
+	heur.UpdateQuiet(pos, bc4, nil, 2)
+
+	if !heur.Killers[0][pos.Ply].Equal(bc4) || !heur.Killers[1][pos.Ply].Equal(nf3) {
+		t.Errorf("killers %v %v, want %v %v", heur.Killers[0][pos.Ply], heur.Killers[1][pos.Ply], bc4, nf3)
+	}
+
+	if !heur.IsKiller(pos.Ply, nf3) || heur.IsKiller(pos.Ply, a3) || heur.IsKiller(pos.Ply+1, nf3) {
+		t.Errorf("killers not recognized at their own ply")
+	}
+
+	// After a null move there is no move to counter.
+	heur.Push(pos.Ply, NoMove, Empty)
+	if counter := heur.CounterMove(pos.Ply + 1); counter != NoMove {
+		t.Errorf("counter move %v to a null move", counter)
+	}
+
+	heur.Clear()
+	if heur.QuietScore(pos, nf3) != 0 || heur.IsKiller(pos.Ply, bc4) {
+		t.Errorf("scores left after clearing")
+	}
+}
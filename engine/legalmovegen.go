@@ -0,0 +1,230 @@
+package engine
+
+// The squares strictly between two squares on a common rank, file or
+// diagonal, and the whole line through both of them. Empty for squares
+// not on a common line.
+var BetweenMask [64][64]Bitboard
+var LineMask [64][64]Bitboard
+
+func InitLineMasks() {
+	for from := 0; from < 64; from++ {
+		for to := 0; to < 64; to++ {
+			BetweenMask[from][to] = 0
+			LineMask[from][to] = 0
+
+			if from == to {
+				continue
+			}
+
+			if genRookMoves(from, 0)&SetMask[to] != 0 {
+				BetweenMask[from][to] = genRookMoves(from, SetMask[to]) & genRookMoves(to, SetMask[from])
+				LineMask[from][to] = genRookMoves(from, 0)&genRookMoves(to, 0) | SetMask[from] | SetMask[to]
+			} else if genBishopMoves(from, 0)&SetMask[to] != 0 {
+				BetweenMask[from][to] = genBishopMoves(from, SetMask[to]) & genBishopMoves(to, SetMask[from])
+				LineMask[from][to] = genBishopMoves(from, 0)&genBishopMoves(to, 0) | SetMask[from] | SetMask[to]
+			}
+		}
+	}
+}
+
+// What it takes for a move of the side to move to be legal: the pieces
+// giving check, the squares a non-king move has to land on to deal with
+// them, and the pieces pinned to the king.
+type legalInfo struct {
+	kingSq    int
+	checkers  Bitboard
+	checkMask Bitboard
+	pinned    Bitboard
+
+	// The position the masks belong to. No position has an empty board,
+	// so the zero value never matches one.
+	hash     uint64
+	occupied Bitboard
+}
+
+func (pos *BoardStruct) legalInfo() legalInfo {
+	us := pos.SideToMove
+	them := us ^ 1
+	occupied := pos.Sides[Both]
+
+	kingSq := pos.Pieces[AllPieces[us][King]].Msb()
+
+	info := legalInfo{
+		kingSq:    kingSq,
+		checkers:  attackersTo(pos, kingSq, occupied) & pos.Sides[them],
+		checkMask: FullBB,
+		hash:      pos.Hash,
+		occupied:  occupied,
+	}
+
+	switch info.checkers.CountBits() {
+	case 0:
+	case 1:
+		checkerSq := info.checkers.Msb()
+		info.checkMask = BetweenMask[kingSq][checkerSq] | info.checkers
+	default:
+		// Only the king can get out of a double check.
+		info.checkMask = 0
+	}
+
+	// Enemy sliders lined up with the king with exactly one of our pieces
+	// in between pin that piece.
+	rooksQueens := pos.Pieces[AllPieces[them][Rook]] | pos.Pieces[AllPieces[them][Queen]]
+	bishopsQueens := pos.Pieces[AllPieces[them][Bishop]] | pos.Pieces[AllPieces[them][Queen]]
+
+	snipers := (genRookMoves(kingSq, 0) & rooksQueens) | (genBishopMoves(kingSq, 0) & bishopsQueens)
+
+	for snipers != 0 {
+		sniperSq := snipers.PopBit()
+		between := BetweenMask[kingSq][sniperSq] & occupied
+
+		if between.CountBits() == 1 && between&pos.Sides[us] != 0 {
+			info.pinned |= between
+		}
+	}
+
+	return info
+}
+
+// GenerateLegalMoves generates the legal moves of the position. Unlike
+// GenerateAllMoves, no move needs to be made to find out whether it leaves
+// the king in check.
+func GenerateLegalMoves(pos *BoardStruct) []Move {
+	var list MoveList
+	GenerateLegalMoveList(pos, &list)
+
+	return append([]Move(nil), list.Moves[:list.Count]...)
+}
+
+// GenerateLegalMoveList generates the legal moves of the position into the
+// move list.
+func GenerateLegalMoveList(pos *BoardStruct, list *MoveList) {
+	info := pos.legalInfo()
+	us := pos.SideToMove
+
+	kingTargets := KingAttacks[info.kingSq] & ^pos.Sides[us]
+	genMovesFromBB(info.kingSq, kingTargets&pos.safeKingSquares(info.kingSq, kingTargets), pos, list, true, true)
+
+	if info.checkMask == 0 {
+		return
+	}
+
+	if info.checkers == 0 {
+		genCastlingMoves(pos, list)
+	}
+
+	pieceBB := pos.Sides[us] & ^SetMask[info.kingSq]
+
+	for pieceBB != 0 {
+		sq := pieceBB.PopBit()
+		start := list.Count
+
+		genPieceMoves(sq, pos, list, true, true)
+
+		// Keep only the moves dealing with a check and staying on the
+		// line of a pin.
+		mask := info.checkMask
+		if info.pinned&SetMask[sq] != 0 {
+			mask &= LineMask[info.kingSq][sq]
+		}
+
+		count := start
+		for moveNum := start; moveNum < list.Count; moveNum++ {
+			move := list.Moves[moveNum]
+
+			if move.MoveType() == Attack && move.Flag() == AttackEP {
+				if !pos.isLegalEnPassant(move, info.kingSq) {
+					continue
+				}
+			} else if mask&SetMask[move.ToSq()] == 0 {
+				continue
+			}
+
+			list.Moves[count] = move
+			count++
+		}
+		list.Count = count
+	}
+}
+
+// IsLegal checks whether the move can be played in the position. The
+// check and pin masks are kept for the next call in the same position.
+func (pos *BoardStruct) IsLegal(move Move) bool {
+	if !pos.IsPseudoLegal(move) {
+		return false
+	}
+
+	if pos.legal.hash != pos.Hash || pos.legal.occupied != pos.Sides[Both] {
+		pos.legal = pos.legalInfo()
+	}
+
+	return pos.isLegalPseudoMove(move, &pos.legal)
+}
+
+// Check whether a pseudo-legal move keeps the king out of check, given the
+// check and pin masks of the position.
+func (pos *BoardStruct) isLegalPseudoMove(move Move, info *legalInfo) bool {
+	from := move.FromSq()
+	to := move.ToSq()
+
+	if from == info.kingSq {
+		// Castling moves are only generated when the king doesn't pass
+		// through an attacked square.
+		if move.MoveType() == Castle {
+			return info.checkers == 0
+		}
+
+		return pos.safeKingSquares(from, SetMask[to]) != 0
+	}
+
+	if move.MoveType() == Attack && move.Flag() == AttackEP {
+		return pos.isLegalEnPassant(move, info.kingSq)
+	}
+
+	if info.checkMask&SetMask[to] == 0 {
+		return false
+	}
+
+	return info.pinned&SetMask[from] == 0 || LineMask[info.kingSq][from]&SetMask[to] != 0
+}
+
+// Get the target squares the king can move to without being attacked. The
+// king is taken off the board first, so it can't hide from a slider
+// behind itself.
+func (pos *BoardStruct) safeKingSquares(kingSq int, targets Bitboard) Bitboard {
+	them := pos.SideToMove ^ 1
+	occupied := pos.Sides[Both] & ^SetMask[kingSq]
+	safe := Bitboard(0)
+
+	for targets != 0 {
+		to := targets.PopBit()
+
+		if attackersTo(pos, to, occupied)&pos.Sides[them] == 0 {
+			safe |= SetMask[to]
+		}
+	}
+
+	return safe
+}
+
+// An en passant capture removes two pieces from the capturing pawn's rank
+// at once, which can expose the king in ways the pin masks don't catch.
+// So its legality is checked by looking at the board after the capture.
+func (pos *BoardStruct) isLegalEnPassant(move Move, kingSq int) bool {
+	them := pos.SideToMove ^ 1
+	from := move.FromSq()
+	to := move.ToSq()
+
+	capturedSq := to - 8
+	if pos.SideToMove == Black {
+		capturedSq = to + 8
+	}
+
+	occupied := pos.Sides[Both]
+	occupied &= ^(SetMask[from] | SetMask[capturedSq])
+	occupied |= SetMask[to]
+
+	attackers := attackersTo(pos, kingSq, occupied) & pos.Sides[them] & ^SetMask[capturedSq]
+
+	return attackers == 0
+}
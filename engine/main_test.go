@@ -0,0 +1,94 @@
+package engine
+
+import (
+	"fmt"
+	"math/rand"
+	"os"
+	"testing"
+)
+
+func TestMain(m *testing.M) {
+	InitBitMasks()
+	InitHashKeys()
+	InitTables()
+	InitEvalMasks()
+	InitMvvLva()
+	InitMagic()
+	InitLineMasks()
+	InitReductions()
+
+	os.Exit(m.Run())
+}
+
+// Set up the position of the FEN string, failing the test if it is invalid.
+func mustParseFen(t *testing.T, fen string) *BoardStruct {
+	t.Helper()
+
+	pos := new(BoardStruct)
+	if err := pos.ParseFen(fen); err != nil {
+		t.Fatalf("ParseFen(%q): %v", fen, err)
+	}
+
+	return pos
+}
+
+// Lines of moves with en passant captures, castling and promotions, to
+// check the state DoMove and UndoMove keep up to date incrementally.
+var specialLines = []struct {
+	fen   string
+	moves []string
+}{
+	{FENStart, []string{"e2e4", "d7d5", "e4e5", "f7f5", "e5f6", "g7f6", "g1f3", "d5d4", "c2c4", "d4c3", "b2c3", "c8e6", "f1d3", "b8c6", "e1g1", "d8d7", "b1a3", "e8c8"}},
+	{"r3k2r/1P4p1/8/8/8/8/1p4P1/R3K2R w KQkq - 0 1", []string{"b7a8n", "b2a1n", "e1g1", "g7g5", "g2g4", "e8e7"}},
+	{"4k3/8/8/8/8/8/p4K1P/8 b - - 0 1", []string{"a2a1q", "h2h4", "a1h1", "f2g3", "h1h4"}},
+	{"rnbq1k1r/pp1Pbppp/2p5/8/2B5/8/PPP1NnPP/RNBQK2R w KQ - 1 8", []string{"d7c8r", "d8c8", "e1g1", "f2d1", "c4f7"}},
+}
+
+// Play the special lines and random games from the perft positions, and
+// take all their moves back, calling check after every step.
+func walkLines(t *testing.T, check func(pos *BoardStruct, step string)) {
+	t.Helper()
+
+	for _, line := range specialLines {
+		pos := mustParseFen(t, line.fen)
+		check(pos, line.fen)
+
+		for _, str := range line.moves {
+			move := ParseMove(str, pos)
+			if move == NoMove || !pos.DoMove(move) {
+				t.Fatalf("%s: %s isn't legal", line.fen, str)
+			}
+			check(pos, line.fen+" "+str)
+		}
+
+		for i := len(line.moves) - 1; i >= 0; i-- {
+			pos.UndoMove()
+			check(pos, line.fen+" undo "+line.moves[i])
+		}
+	}
+
+	rng := rand.New(rand.NewSource(1))
+
+	for _, test := range perftPositions {
+		for game := 0; game < 20; game++ {
+			pos := mustParseFen(t, test.fen)
+			plies := 0
+
+			for ; plies < 80; plies++ {
+				moves := GenerateLegalMoves(pos)
+				if len(moves) == 0 {
+					break
+				}
+
+				move := moves[rng.Intn(len(moves))]
+				pos.DoMove(move)
+				check(pos, fmt.Sprintf("%s game %d %s", test.name, game, move))
+			}
+
+			for ; plies > 0; plies-- {
+				pos.UndoMove()
+				check(pos, fmt.Sprintf("%s game %d undo", test.name, game))
+			}
+		}
+	}
+}
@@ -71,6 +71,11 @@ func (move Move) Equal(m Move) bool {
 }
 
 func (move Move) String() string {
+	// The UCI protocol writes the null move as "0000".
+	if move.Equal(NoMove) {
+		return "0000"
+	}
+
 	ff := FileOf(move.FromSq())
 	rf := RankOf(move.FromSq())
 	ft := FileOf(move.ToSq())
@@ -111,7 +116,7 @@ func ParseMove(ptrChar string, pos *BoardStruct) Move {
 	to := FR2SQ(int(ptrChar[2]-'a'), int(ptrChar[3]-'1'))
 
 	var list MoveList
-	GenerateAllMoves(pos, &list, true)
+	GenerateLegalMoveList(pos, &list)
 
 	for moveNum := 0; moveNum < list.Count; moveNum++ {
 		move := list.Moves[moveNum]
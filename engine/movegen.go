@@ -23,41 +23,158 @@ func SQOFFBOARD(sq int) bool {
 }
 
 func GenerateAllMoves(pos *BoardStruct, list *MoveList, genQuiet bool) {
+	generateMoves(pos, list, true, genQuiet)
+}
+
+// GenerateQuietMoves generates the moves not capturing anything, castling
+// and promotions to an empty square included.
+func GenerateQuietMoves(pos *BoardStruct, list *MoveList) {
+	generateMoves(pos, list, false, true)
+}
+
+func generateMoves(pos *BoardStruct, list *MoveList, genCaptures bool, genQuiet bool) {
 	// Copy bitboard of all pieces and loop over them
 	pieceBB := pos.Sides[pos.SideToMove]
 
 	for pieceBB != 0 {
 		sq := pieceBB.PopBit()
-		piece := pos.Squares[sq]
+		genPieceMoves(sq, pos, list, genCaptures, genQuiet)
+	}
 
-		if PiecePawn[piece] {
-			genPawnMoves(sq, pos, list, genQuiet)
-		}
+	if genQuiet {
+		genCastlingMoves(pos, list)
+	}
+}
+
+func genPieceMoves(sq int, pos *BoardStruct, list *MoveList, genCaptures bool, genQuiet bool) {
+	piece := pos.Squares[sq]
+
+	if PiecePawn[piece] {
+		genPawnMoves(sq, pos, list, genCaptures, genQuiet)
+	}
+
+	if PieceKnight[piece] {
+		knightAttacks := KnightAttacks[sq] & ^pos.Sides[pos.SideToMove]
+		genMovesFromBB(sq, knightAttacks, pos, list, genCaptures, genQuiet)
+	}
+
+	if PieceBishopQueen[piece] {
+		bishopAttacks := genBishopMoves(sq, pos.Sides[Both]) & ^pos.Sides[pos.SideToMove]
+		genMovesFromBB(sq, bishopAttacks, pos, list, genCaptures, genQuiet)
+	}
+
+	if PieceRookQueen[piece] {
+		rookAttacks := genRookMoves(sq, pos.Sides[Both]) & ^pos.Sides[pos.SideToMove]
+		genMovesFromBB(sq, rookAttacks, pos, list, genCaptures, genQuiet)
+	}
+
+	if PieceKing[piece] {
+		kingAttacks := KingAttacks[sq] & ^pos.Sides[pos.SideToMove]
+		genMovesFromBB(sq, kingAttacks, pos, list, genCaptures, genQuiet)
+	}
+}
+
+// IsPseudoLegal checks whether the move could be generated in the position,
+// ignoring whether it leaves the king in check. Used to validate moves that
+// don't come from the move generator, like killers and table moves. Apart
+// from castling, the move is checked directly instead of generating the
+// moves of the piece.
+func (pos *BoardStruct) IsPseudoLegal(move Move) bool {
+	from := move.FromSq()
+	to := move.ToSq()
+	us := pos.SideToMove
+	piece := pos.Squares[from]
+
+	if move.Equal(NoMove) || piece == Empty || PieceCol[piece] != us || pos.Sides[us]&SetMask[to] != 0 {
+		return false
+	}
+
+	if move.MoveType() == Castle {
+		var list MoveList
+		genCastlingMoves(pos, &list)
+
+		return list.Contains(move)
+	}
+
+	if PiecePawn[piece] {
+		return pos.isPseudoLegalPawnMove(move)
+	}
 
-		if PieceKnight[piece] {
-			knightAttacks := KnightAttacks[sq] & ^pos.Sides[pos.SideToMove]
-			genMovesFromBB(sq, knightAttacks, pos, list, genQuiet)
+	// The other pieces capture with an attack and move quietly otherwise,
+	// never with a flag.
+	if move.Flag() != NoFlag {
+		return false
+	}
+
+	if pos.Sides[us^1]&SetMask[to] != 0 {
+		if move.MoveType() != Attack {
+			return false
 		}
+	} else if move.MoveType() != Quiet {
+		return false
+	}
+
+	var attacks Bitboard
 
+	switch {
+	case PieceKnight[piece]:
+		attacks = KnightAttacks[from]
+	case PieceKing[piece]:
+		attacks = KingAttacks[from]
+	default:
 		if PieceBishopQueen[piece] {
-			bishopAttacks := genBishopMoves(sq, pos.Sides[Both]) & ^pos.Sides[pos.SideToMove]
-			genMovesFromBB(sq, bishopAttacks, pos, list, genQuiet)
+			attacks |= genBishopMoves(from, pos.Sides[Both])
 		}
-
 		if PieceRookQueen[piece] {
-			rookAttacks := genRookMoves(sq, pos.Sides[Both]) & ^pos.Sides[pos.SideToMove]
-			genMovesFromBB(sq, rookAttacks, pos, list, genQuiet)
+			attacks |= genRookMoves(from, pos.Sides[Both])
+		}
+	}
+
+	return attacks&SetMask[to] != 0
+}
+
+// Pawn moves are encoded the way genPawnMoves generates them: captures and
+// pushes as quiet moves, double pushes with their flag, and both as
+// promotions from the rank before the last. Only en passant is an attack.
+func (pos *BoardStruct) isPseudoLegalPawnMove(move Move) bool {
+	from := move.FromSq()
+	to := move.ToSq()
+	us := pos.SideToMove
+
+	forward, startRank, beforePromRank := 8, R2, R7
+	if us == Black {
+		forward, startRank, beforePromRank = -8, R7, R2
+	}
+
+	captures := PawnAttacks[us^1][from]
+
+	switch move.MoveType() {
+	case Attack:
+		return move.Flag() == AttackEP && pos.EnPas != NoSq && to == pos.EnPas && captures&SetMask[to] != 0
+	case Promotion:
+		if RankOf(from) != beforePromRank {
+			return false
+		}
+	case Quiet:
+		if RankOf(from) == beforePromRank {
+			return false
 		}
 
-		if PieceKing[piece] {
-			kingAttacks := KingAttacks[sq] & ^pos.Sides[pos.SideToMove]
-			genMovesFromBB(sq, kingAttacks, pos, list, genQuiet)
+		if move.Flag() == DoublePawnPush {
+			return RankOf(from) == startRank && to == from+2*forward &&
+				pos.Sides[Both]&(SetMask[from+forward]|SetMask[to]) == 0
+		} else if move.Flag() != NoFlag {
+			return false
 		}
+	default:
+		return false
 	}
 
-	if genQuiet {
-		genCastlingMoves(pos, list)
+	if captures&SetMask[to] != 0 {
+		return pos.Sides[us^1]&SetMask[to] != 0
 	}
+
+	return to == from+forward && pos.Sides[Both]&SetMask[to] == 0
 }
 
 func SqAttacked(targetSq int, pos *BoardStruct, side uint8) bool {
@@ -107,22 +224,24 @@ func SqAttacked(targetSq int, pos *BoardStruct, side uint8) bool {
 	return false
 }
 
-func genPawnMoves(sq int, pos *BoardStruct, list *MoveList, genQuiet bool) {
-	attacks := PawnAttacks[pos.SideToMove^1][sq] & pos.Sides[pos.SideToMove^1]
-	for attacks != 0 {
-		targetSq := attacks.PopBit()
+func genPawnMoves(sq int, pos *BoardStruct, list *MoveList, genCaptures bool, genQuiet bool) {
+	if genCaptures {
+		attacks := PawnAttacks[pos.SideToMove^1][sq] & pos.Sides[pos.SideToMove^1]
+		for attacks != 0 {
+			targetSq := attacks.PopBit()
 
-		list.AddPawnCapMove(pos, sq, targetSq, pos.Squares[targetSq], pos.SideToMove)
-	}
+			list.AddPawnCapMove(pos, sq, targetSq, pos.Squares[targetSq], pos.SideToMove)
+		}
 
-	if pos.EnPas != NoSq {
-		enPasAttacks := PawnAttacks[pos.SideToMove^1][sq] & (1 << pos.EnPas)
+		if pos.EnPas != NoSq {
+			enPasAttacks := PawnAttacks[pos.SideToMove^1][sq] & (1 << pos.EnPas)
 
-		if enPasAttacks != 0 {
-			targetSq := enPasAttacks.PopBit()
+			if enPasAttacks != 0 {
+				targetSq := enPasAttacks.PopBit()
 
-			move := NewMove(sq, targetSq, Attack, AttackEP)
-			list.AddEnPassantMove(pos, move)
+				move := NewMove(sq, targetSq, Attack, AttackEP)
+				list.AddEnPassantMove(pos, move)
+			}
 		}
 	}
 
@@ -139,11 +258,11 @@ func genPawnMoves(sq int, pos *BoardStruct, list *MoveList, genQuiet bool) {
 		twoPawnPush := sq + (16 * dir)
 
 		if !SQOFFBOARD(onePawnPush) && pos.Sides[Both]&(1<<onePawnPush) == 0 {
-			list.AddPawnMove(pos, sq, onePawnPush, pos.SideToMove)
+			list.AddPawnMove(sq, onePawnPush, pos.SideToMove)
 
 			if RankOf(sq) == fistPawnRank && pos.Sides[Both]&(1<<twoPawnPush) == 0 {
 				move := NewMove(sq, twoPawnPush, Quiet, DoublePawnPush)
-				list.AddQuietMove(pos, move)
+				list.AddQuietMove(move)
 			}
 		}
 	}
@@ -154,41 +273,43 @@ func genCastlingMoves(pos *BoardStruct, list *MoveList) {
 	if pos.SideToMove == White {
 		if pos.CastlePerm&wKCastle != 0 && (pos.Sides[Both]&F1_G1) == 0 && !SqAttacked(E1, pos, Black) {
 			if !SqAttacked(F1, pos, Black) && !SqAttacked(G1, pos, Black) {
-				list.AddQuietMove(pos, NewMove(E1, G1, Castle, NoFlag))
+				list.AddQuietMove(NewMove(E1, G1, Castle, NoFlag))
 			}
 		}
 
 		if pos.CastlePerm&wQCastle != 0 && (pos.Sides[Both]&B1_C1_D1) == 0 && !SqAttacked(E1, pos, Black) {
 			if !SqAttacked(C1, pos, Black) && !SqAttacked(D1, pos, Black) {
-				list.AddQuietMove(pos, NewMove(E1, C1, Castle, NoFlag))
+				list.AddQuietMove(NewMove(E1, C1, Castle, NoFlag))
 			}
 		}
 	} else {
 		if pos.CastlePerm&bKCastle != 0 && (pos.Sides[Both]&F8_G8) == 0 && !SqAttacked(E8, pos, White) {
 			if !SqAttacked(F8, pos, White) && !SqAttacked(G8, pos, White) {
-				list.AddQuietMove(pos, NewMove(E8, G8, Castle, NoFlag))
+				list.AddQuietMove(NewMove(E8, G8, Castle, NoFlag))
 			}
 		}
 
 		if pos.CastlePerm&bQCastle != 0 && (pos.Sides[Both]&B8_C8_D8) == 0 && !SqAttacked(E8, pos, White) {
 			if !SqAttacked(C8, pos, White) && !SqAttacked(D8, pos, White) {
-				list.AddQuietMove(pos, NewMove(E8, C8, Castle, NoFlag))
+				list.AddQuietMove(NewMove(E8, C8, Castle, NoFlag))
 			}
 		}
 	}
 
 }
 
-func genMovesFromBB(sq int, attacks Bitboard, pos *BoardStruct, list *MoveList, genQuiet bool) {
+func genMovesFromBB(sq int, attacks Bitboard, pos *BoardStruct, list *MoveList, genCaptures bool, genQuiet bool) {
 	for attacks != 0 {
 		targetSq := attacks.PopBit()
 
 		if pos.Sides[pos.SideToMove^1]&(1<<targetSq) != 0 {
-			list.AddCaptureMove(pos, NewMove(sq, targetSq, Attack, NoFlag))
+			if genCaptures {
+				list.AddCaptureMove(pos, NewMove(sq, targetSq, Attack, NoFlag))
+			}
 			continue
 		}
 		if genQuiet {
-			list.AddQuietMove(pos, NewMove(sq, targetSq, Quiet, NoFlag))
+			list.AddQuietMove(NewMove(sq, targetSq, Quiet, NoFlag))
 		}
 	}
 }
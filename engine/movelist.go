@@ -22,17 +22,10 @@ func InitMvvLva() {
 	}
 }
 
-func (list *MoveList) AddQuietMove(pos *BoardStruct, move Move) {
+// Quiet moves are added unscored. The search scores them afterwards using
+// the killer and history tables of the thread generating them.
+func (list *MoveList) AddQuietMove(move Move) {
 	list.Moves[list.Count] = move
-
-	if pos.SearchKillers[0][pos.Ply] == move {
-		list.Moves[list.Count].AddScore(MvvLvaOffset - FirstKillerMoveScore)
-	} else if pos.SearchKillers[1][pos.Ply] == move {
-		list.Moves[list.Count].AddScore(MvvLvaOffset - SecondKillerMoveScore)
-	} else {
-		list.Moves[list.Count].AddScore(pos.SearchHistory[pos.Squares[move.FromSq()]][move.ToSq()])
-	}
-
 	list.Count++
 }
 
@@ -68,7 +61,7 @@ func (list *MoveList) AddPawnCapMove(pos *BoardStruct, from int, to int, cap uin
 	}
 }
 
-func (list *MoveList) AddPawnMove(pos *BoardStruct, from int, to int, side uint8) {
+func (list *MoveList) AddPawnMove(from int, to int, side uint8) {
 	beforePromRank := R7
 
 	if side == Black {
@@ -76,12 +69,12 @@ func (list *MoveList) AddPawnMove(pos *BoardStruct, from int, to int, side uint8
 	}
 
 	if RankOf(from) == beforePromRank {
-		list.AddQuietMove(pos, NewMove(from, to, Promotion, KnightPromotion))
-		list.AddQuietMove(pos, NewMove(from, to, Promotion, BishopPromotion))
-		list.AddQuietMove(pos, NewMove(from, to, Promotion, RookPromotion))
-		list.AddQuietMove(pos, NewMove(from, to, Promotion, QueenPromotion))
+		list.AddQuietMove(NewMove(from, to, Promotion, KnightPromotion))
+		list.AddQuietMove(NewMove(from, to, Promotion, BishopPromotion))
+		list.AddQuietMove(NewMove(from, to, Promotion, RookPromotion))
+		list.AddQuietMove(NewMove(from, to, Promotion, QueenPromotion))
 	} else {
-		list.AddQuietMove(pos, NewMove(from, to, Quiet, NoFlag))
+		list.AddQuietMove(NewMove(from, to, Quiet, NoFlag))
 	}
 }
 
@@ -102,6 +95,16 @@ func (list *MoveList) PickNextMove(moveIndex int) {
 	list.Moves[bestNum] = tempMove
 }
 
+func (list *MoveList) Contains(move Move) bool {
+	for i := 0; i < list.Count; i++ {
+		if list.Moves[i].Equal(move) {
+			return true
+		}
+	}
+
+	return false
+}
+
 func (list *MoveList) String() string {
 	moveListStr := "MoveList:\n"
 
@@ -0,0 +1,201 @@
+package engine
+
+// The stages of the move picker, in the order the moves are tried.
+const (
+	stageTTMove = iota
+	stageGenCaptures
+	stageGoodCaptures
+	stageFirstKiller
+	stageSecondKiller
+	stageCounterMove
+	stageGenQuiets
+	stageQuiets
+	stageBadCaptures
+	stageDone
+)
+
+// MovePicker hands out the legal moves of a position one by one, best
+// first. Moves are generated in stages, and a stage is only generated
+// once the moves before it are used up, which saves the work of generating
+// and scoring everything at nodes where an early move already causes a
+// beta cutoff. The generated moves are pseudo-legal, they are checked
+// against the check and pin masks of the position before being handed
+// out, so the search can make them without checking them again.
+type MovePicker struct {
+	pos  *BoardStruct
+	heur *Heuristics
+
+	legal legalInfo
+
+	stage    int
+	genQuiet bool
+
+	ttMove      Move
+	killers     [2]Move
+	counterMove Move
+
+	list   MoveList
+	scores [maxPositionMoves]int
+	index  int
+
+	badCaptures [maxPositionMoves]Move
+	badCount    int
+	badIndex    int
+}
+
+// Set up the picker for the position. Without genQuiet only captures
+// that don't lose material are returned, as used by the quiescence search.
+func (mp *MovePicker) Init(pos *BoardStruct, heur *Heuristics, ttMove Move, genQuiet bool) {
+	mp.pos = pos
+	mp.heur = heur
+	mp.stage = stageTTMove
+	mp.genQuiet = genQuiet
+	mp.legal = pos.legalInfo()
+
+	mp.ttMove = NoMove
+	if pos.IsPseudoLegal(ttMove) && (genQuiet || (pos.IsCapture(ttMove) && SEE(pos, ttMove) >= 0)) {
+		mp.ttMove = ttMove
+	}
+
+	mp.killers = [2]Move{heur.Killers[0][pos.Ply], heur.Killers[1][pos.Ply]}
+	mp.counterMove = heur.CounterMove(pos.Ply)
+
+	mp.list.Count = 0
+	mp.index = 0
+	mp.badCount = 0
+	mp.badIndex = 0
+}
+
+// Get the next move to search, or NoMove once all moves are used up.
+func (mp *MovePicker) Next() Move {
+	for {
+		move := mp.nextPseudoLegal()
+
+		if move == NoMove || mp.pos.isLegalPseudoMove(move, &mp.legal) {
+			return move
+		}
+	}
+}
+
+func (mp *MovePicker) nextPseudoLegal() Move {
+	for {
+		switch mp.stage {
+		case stageTTMove:
+			mp.stage++
+
+			if mp.ttMove != NoMove {
+				return mp.ttMove
+			}
+		case stageGenCaptures:
+			GenerateAllMoves(mp.pos, &mp.list, false)
+
+			for moveNum := 0; moveNum < mp.list.Count; moveNum++ {
+				mp.scores[moveNum] = int(mp.list.Moves[moveNum].Score())
+			}
+
+			mp.index = 0
+			mp.stage++
+		case stageGoodCaptures:
+			if mp.index == mp.list.Count {
+				mp.stage++
+
+				if !mp.genQuiet {
+					mp.stage = stageDone
+				}
+				continue
+			}
+
+			move := mp.pickBest()
+
+			if move.Equal(mp.ttMove) {
+				continue
+			}
+
+			// Captures losing material are put aside for the last stage.
+			if SEE(mp.pos, move) < 0 {
+				mp.badCaptures[mp.badCount] = move
+				mp.badCount++
+				continue
+			}
+
+			return move
+		case stageFirstKiller, stageSecondKiller:
+			killer := mp.killers[mp.stage-stageFirstKiller]
+			mp.stage++
+
+			if mp.isSpecialQuiet(killer) {
+				return killer
+			}
+		case stageCounterMove:
+			mp.stage++
+
+			if mp.isSpecialQuiet(mp.counterMove) && !mp.counterMove.Equal(mp.killers[0]) && !mp.counterMove.Equal(mp.killers[1]) {
+				return mp.counterMove
+			}
+		case stageGenQuiets:
+			mp.list.Count = 0
+			GenerateQuietMoves(mp.pos, &mp.list)
+
+			for moveNum := 0; moveNum < mp.list.Count; moveNum++ {
+				mp.scores[moveNum] = mp.heur.QuietScore(mp.pos, mp.list.Moves[moveNum])
+			}
+
+			mp.index = 0
+			mp.stage++
+		case stageQuiets:
+			if mp.index == mp.list.Count {
+				mp.stage++
+				continue
+			}
+
+			move := mp.pickBest()
+
+			if move.Equal(mp.ttMove) || move.Equal(mp.killers[0]) || move.Equal(mp.killers[1]) || move.Equal(mp.counterMove) {
+				continue
+			}
+
+			return move
+		case stageBadCaptures:
+			if mp.badIndex == mp.badCount {
+				mp.stage++
+				continue
+			}
+
+			move := mp.badCaptures[mp.badIndex]
+			mp.badIndex++
+
+			return move
+		default:
+			return NoMove
+		}
+	}
+}
+
+// Take the best scored of the remaining moves of the current stage.
+func (mp *MovePicker) pickBest() Move {
+	bestNum := mp.index
+
+	for moveNum := mp.index + 1; moveNum < mp.list.Count; moveNum++ {
+		if mp.scores[moveNum] > mp.scores[bestNum] {
+			bestNum = moveNum
+		}
+	}
+
+	mp.list.Moves[mp.index], mp.list.Moves[bestNum] = mp.list.Moves[bestNum], mp.list.Moves[mp.index]
+	mp.scores[mp.index], mp.scores[bestNum] = mp.scores[bestNum], mp.scores[mp.index]
+
+	move := mp.list.Moves[mp.index]
+	mp.index++
+
+	return move
+}
+
+// Check whether a killer or counter move can be played as a quiet move
+// here, and wasn't already tried as the table move.
+func (mp *MovePicker) isSpecialQuiet(move Move) bool {
+	return move != NoMove &&
+		!move.Equal(mp.ttMove) &&
+		!mp.pos.IsCapture(move) &&
+		move.MoveType() != Promotion &&
+		mp.pos.IsPseudoLegal(move)
+}
@@ -0,0 +1,104 @@
+package engine
+
+import "testing"
+
+func TestMovePicker(t *testing.T) {
+	for _, test := range perftPositions {
+		pos := mustParseFen(t, test.fen)
+
+		var captures, quiets MoveList
+		GenerateAllMoves(pos, &captures, false)
+		GenerateQuietMoves(pos, &quiets)
+
+		// Fill the heuristics with a few scores, killers and a counter move
+		// to the previous move. The second killer is a capture, which the
+		// picker leaves to the capture stages.
+		var heur Heuristics
+		pos.Ply = 1
+		heur.Push(0, NewMove(A7, A6, Quiet, NoFlag), bPawn)
+		heur.UpdateQuiet(pos, quiets.Moves[3], quiets.Moves[4:8], 5)
+
+		ttMove := quiets.Moves[quiets.Count-1]
+		heur.Killers[0][pos.Ply] = quiets.Moves[0]
+		heur.Killers[1][pos.Ply] = captures.Moves[0]
+		heur.CounterMoves[bPawn][A6] = quiets.Moves[1]
+
+		stageOf := func(move Move) int {
+			switch {
+			case move.Equal(ttMove):
+				return stageTTMove
+			case captures.Contains(move) && SEE(pos, move) >= 0:
+				return stageGoodCaptures
+			case captures.Contains(move):
+				return stageBadCaptures
+			case move.Equal(quiets.Moves[0]):
+				return stageFirstKiller
+			case move.Equal(quiets.Moves[1]):
+				return stageCounterMove
+			}
+			return stageQuiets
+		}
+
+		var picker MovePicker
+		picker.Init(pos, &heur, ttMove, true)
+
+		picked := make(map[Move]int)
+		var prev Move
+		prevStage := stageTTMove
+
+		for move := picker.Next(); move != NoMove; move = picker.Next() {
+			key := move & 0xffff0000
+			picked[key]++
+
+			if picked[key] > 1 {
+				t.Errorf("%s: %v picked twice", test.name, move)
+			}
+
+			if stage := stageOf(move); stage < prevStage {
+				t.Errorf("%s: %v of stage %d after %v of stage %d", test.name, move, stage, prev, prevStage)
+			} else if stage == prevStage && stage == stageGoodCaptures && move.Score() > prev.Score() {
+				t.Errorf("%s: capture %v scored %d after %v scored %d", test.name, move, move.Score(), prev, prev.Score())
+			} else if stage == prevStage && stage == stageQuiets && heur.QuietScore(pos, move) > heur.QuietScore(pos, prev) {
+				t.Errorf("%s: quiet move %v ordered after the lower scored %v", test.name, move, prev)
+			} else {
+				prevStage = stage
+			}
+
+			prev = move
+		}
+
+		legal := GenerateLegalMoves(pos)
+		if len(picked) != len(legal) {
+			t.Errorf("%s: %d moves picked, want %d", test.name, len(picked), len(legal))
+		}
+
+		for _, move := range legal {
+			if picked[move&0xffff0000] == 0 {
+				t.Errorf("%s: legal move %v not picked", test.name, move)
+			}
+		}
+
+		// Without quiet moves, the quiescence search only gets the legal
+		// captures that don't lose material.
+		picker.Init(pos, &heur, ttMove, false)
+
+		count := 0
+		for move := picker.Next(); move != NoMove; move = picker.Next() {
+			if stageOf(move) != stageGoodCaptures {
+				t.Errorf("%s: %v picked without quiet moves", test.name, move)
+			}
+			count++
+		}
+
+		want := 0
+		for _, move := range legal {
+			if captures.Contains(move) && SEE(pos, move) >= 0 {
+				want++
+			}
+		}
+
+		if count != want {
+			t.Errorf("%s: %d captures picked without quiet moves, want %d", test.name, count, want)
+		}
+	}
+}
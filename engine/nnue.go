@@ -0,0 +1,150 @@
+package engine
+
+import (
+	"bufio"
+	"encoding/binary"
+	"os"
+)
+
+// The NNUE network is a simple 768->N->1 perceptron evaluated from both
+// perspectives. Each side has its own accumulator holding the hidden layer
+// for the pieces seen from its side of the board, with its own pieces
+// first. The output layer sees the accumulator of the side to move
+// followed by the one of the other side.
+const (
+	NNUEInputs = 768
+	NNUEHidden = 256
+
+	// The quantization of the network: the accumulator is scaled by
+	// NNUEQA, the output weights by NNUEQB, and the output is turned into
+	// centipawns by NNUEScale.
+	NNUEQA    = 255
+	NNUEQB    = 64
+	NNUEScale = 400
+)
+
+// Network holds the quantized weights of the NNUE network. The network
+// file holds the fields in this order as little endian 16 bit integers,
+// the output bias scaled by NNUEQA * NNUEQB. Anything after the output
+// bias, like padding, is ignored.
+type Network struct {
+	FeatureWeights [NNUEInputs][NNUEHidden]int16
+	FeatureBias    [NNUEHidden]int16
+	OutputWeights  [2 * NNUEHidden]int16
+	OutputBias     int16
+}
+
+// Accumulator holds the hidden layer of the network for both sides. It is
+// kept up to date by AddPiece, ClearPiece and MovePiece, so UndoMove
+// restores it just like the bitboards.
+type Accumulator [2][NNUEHidden]int16
+
+func LoadNetwork(path string) (*Network, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	net := new(Network)
+	if err := binary.Read(bufio.NewReader(file), binary.LittleEndian, net); err != nil {
+		return nil, err
+	}
+
+	return net, nil
+}
+
+// Get the input of the piece on the square, seen from the perspective.
+func featureIndex(perspective uint8, piece uint8, sq int) int {
+	pieceType := int(piece-1) % 6
+
+	if perspective == Black {
+		sq = Mirror(sq)
+	}
+
+	if PieceCol[piece] == perspective {
+		return pieceType*64 + sq
+	}
+
+	return 384 + pieceType*64 + sq
+}
+
+// Compute the accumulator from scratch for all pieces of the position.
+func (acc *Accumulator) Refresh(net *Network, pos *BoardStruct) {
+	acc[White] = net.FeatureBias
+	acc[Black] = net.FeatureBias
+
+	for sq := 0; sq < 64; sq++ {
+		if piece := pos.Squares[sq]; piece != Empty {
+			acc.add(net, piece, sq)
+		}
+	}
+}
+
+func (acc *Accumulator) add(net *Network, piece uint8, sq int) {
+	for side := White; side <= Black; side++ {
+		weights := &net.FeatureWeights[featureIndex(side, piece, sq)]
+
+		for i := range acc[side] {
+			acc[side][i] += weights[i]
+		}
+	}
+}
+
+func (acc *Accumulator) remove(net *Network, piece uint8, sq int) {
+	for side := White; side <= Black; side++ {
+		weights := &net.FeatureWeights[featureIndex(side, piece, sq)]
+
+		for i := range acc[side] {
+			acc[side][i] -= weights[i]
+		}
+	}
+}
+
+func (acc *Accumulator) move(net *Network, piece uint8, from int, to int) {
+	for side := White; side <= Black; side++ {
+		fromWeights := &net.FeatureWeights[featureIndex(side, piece, from)]
+		toWeights := &net.FeatureWeights[featureIndex(side, piece, to)]
+
+		for i := range acc[side] {
+			acc[side][i] += toWeights[i] - fromWeights[i]
+		}
+	}
+}
+
+// Get the output of the network for the accumulator, from the point of
+// view of the side to move. The output is kept clear of the mate scores.
+func (net *Network) Evaluate(acc *Accumulator, sideToMove uint8) int {
+	us := &acc[sideToMove]
+	them := &acc[sideToMove^1]
+
+	output := 0
+
+	for i := 0; i < NNUEHidden; i++ {
+		output += crelu(us[i]) * int(net.OutputWeights[i])
+		output += crelu(them[i]) * int(net.OutputWeights[NNUEHidden+i])
+	}
+
+	output += int(net.OutputBias)
+	eval := output * NNUEScale / (NNUEQA * NNUEQB)
+
+	return min(max(eval, -ISMATE+1), ISMATE-1)
+}
+
+func crelu(x int16) int {
+	return int(min(max(x, 0), NNUEQA))
+}
+
+// NNUEEvaluator evaluates positions with the NNUE network.
+type NNUEEvaluator struct {
+	Net *Network
+}
+
+func (e NNUEEvaluator) Init(pos *BoardStruct) {
+	pos.Net = e.Net
+	pos.Acc.Refresh(e.Net, pos)
+}
+
+func (e NNUEEvaluator) Evaluate(pos *BoardStruct) int {
+	return e.Net.Evaluate(&pos.Acc, pos.SideToMove)
+}
@@ -0,0 +1,117 @@
+package engine
+
+import (
+	"encoding/binary"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// A network with small random weights, which can't overflow the
+// accumulator.
+func randomNetwork(seed int64) *Network {
+	rng := rand.New(rand.NewSource(seed))
+	net := new(Network)
+
+	for i := range net.FeatureWeights {
+		for j := range net.FeatureWeights[i] {
+			net.FeatureWeights[i][j] = int16(rng.Intn(129) - 64)
+		}
+	}
+
+	for i := range net.FeatureBias {
+		net.FeatureBias[i] = int16(rng.Intn(257) - 128)
+	}
+
+	for i := range net.OutputWeights {
+		net.OutputWeights[i] = int16(rng.Intn(129) - 64)
+	}
+
+	net.OutputBias = int16(rng.Intn(2049) - 1024)
+
+	return net
+}
+
+func TestAccumulatorUpdates(t *testing.T) {
+	net := randomNetwork(1)
+	evaluator := NNUEEvaluator{Net: net}
+
+	walkLines(t, func(pos *BoardStruct, step string) {
+		// Every line starts from a new position without a network.
+		if pos.Net == nil {
+			evaluator.Init(pos)
+		}
+
+		var fresh Accumulator
+		fresh.Refresh(net, pos)
+
+		if pos.Acc != fresh {
+			t.Fatalf("%s: accumulator differs from a refresh", step)
+		}
+
+		if eval := evaluator.Evaluate(pos); eval != net.Evaluate(&fresh, pos.SideToMove) {
+			t.Fatalf("%s: evaluation %d, want %d", step, eval, net.Evaluate(&fresh, pos.SideToMove))
+		}
+	})
+}
+
+// The network sees the board from the side to move, so a position and its
+// color flipped copy get the same evaluation.
+func TestNNUEColorSymmetry(t *testing.T) {
+	net := randomNetwork(2)
+
+	fens := [][2]string{
+		{FENStart, "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR b KQkq - 0 1"},
+		{"r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1",
+			"r3k2r/pppbbppp/2n2q1P/1P2p3/3pn3/BN2PNP1/P1PPQPB1/R3K2R b KQkq - 0 1"},
+		{"8/2p5/3p4/KP5r/1R3p1k/8/4P1P1/8 w - - 0 1", "8/4p1p1/8/1r3P1K/kp5R/3P4/2P5/8 b - - 0 1"},
+	}
+
+	for _, pair := range fens {
+		pos := mustParseFen(t, pair[0])
+		flipped := mustParseFen(t, pair[1])
+
+		NNUEEvaluator{Net: net}.Init(pos)
+		NNUEEvaluator{Net: net}.Init(flipped)
+
+		if eval, flippedEval := net.Evaluate(&pos.Acc, pos.SideToMove), net.Evaluate(&flipped.Acc, flipped.SideToMove); eval != flippedEval {
+			t.Errorf("%s: evaluation %d, %d with colors flipped", pair[0], eval, flippedEval)
+		}
+	}
+}
+
+func TestLoadNetwork(t *testing.T) {
+	net := randomNetwork(3)
+	path := filepath.Join(t.TempDir(), "net.nnue")
+
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := binary.Write(file, binary.LittleEndian, net); err != nil {
+		t.Fatal(err)
+	}
+
+	// Padding after the output bias is ignored.
+	file.Write(make([]byte, 30))
+	file.Close()
+
+	loaded, err := LoadNetwork(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if *loaded != *net {
+		t.Errorf("loaded network differs from the written one")
+	}
+
+	if err := os.Truncate(path, 1000); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := LoadNetwork(path); err == nil {
+		t.Errorf("truncated network loaded")
+	}
+}
@@ -0,0 +1,207 @@
+package engine
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// EvalParam is a named group of evaluation weights that can be tuned and
+// written to or loaded from a parameter file. The weights are either
+// tapered scores, made of a middlegame and an endgame value, or plain
+// integers.
+type EvalParam struct {
+	Name   string
+	Scores []*Score
+	Values []*int
+}
+
+// All evaluation weights that are tuned and kept in parameter files.
+var EvalParams = []EvalParam{
+	{Name: "PieceScore", Scores: scoreRefs(Weights.PieceScore[Pawn:King])},
+
+	{Name: "PstPawnMG", Values: intRefs(Weights.PstPawnMG[:])},
+	{Name: "PstPawnEG", Values: intRefs(Weights.PstPawnEG[:])},
+	{Name: "PstKnightMG", Values: intRefs(Weights.PstKnightMG[:])},
+	{Name: "PstKnightEG", Values: intRefs(Weights.PstKnightEG[:])},
+	{Name: "PstBishopMG", Values: intRefs(Weights.PstBishopMG[:])},
+	{Name: "PstBishopEG", Values: intRefs(Weights.PstBishopEG[:])},
+	{Name: "PstRookMG", Values: intRefs(Weights.PstRookMG[:])},
+	{Name: "PstRookEG", Values: intRefs(Weights.PstRookEG[:])},
+	{Name: "PstQueenMG", Values: intRefs(Weights.PstQueenMG[:])},
+	{Name: "PstQueenEG", Values: intRefs(Weights.PstQueenEG[:])},
+	{Name: "PstKingMG", Values: intRefs(Weights.PstKingMG[:])},
+	{Name: "PstKingEG", Values: intRefs(Weights.PstKingEG[:])},
+
+	{Name: "IsolatedPawnPenalty", Scores: []*Score{&Weights.IsolatedPawnPenalty}},
+	{Name: "DoublePawnPenalty", Scores: []*Score{&Weights.DoublePawnPenalty}},
+	{Name: "BackwardPawnPenalty", Scores: []*Score{&Weights.BackwardPawnPenalty}},
+	{Name: "PawnConnected", Scores: scoreRefs(Weights.PawnConnected[:])},
+	{Name: "PawnPhalanx", Scores: scoreRefs(Weights.PawnPhalanx[:])},
+	{Name: "PawnCandidate", Scores: scoreRefs(Weights.PawnCandidate[:])},
+	{Name: "PawnPassed", Scores: scoreRefs(Weights.PawnPassed[:])},
+	{Name: "PassedOwnKingDistance", Scores: scoreRefs(Weights.PassedOwnKingDistance[:])},
+	{Name: "PassedEnemyKingDistance", Scores: scoreRefs(Weights.PassedEnemyKingDistance[:])},
+	{Name: "PassedFreePath", Scores: scoreRefs(Weights.PassedFreePath[:])},
+
+	{Name: "Mobility", Scores: scoreRefs(Weights.Mobility[Knight:King])},
+	{Name: "RookOpenFile", Scores: []*Score{&Weights.RookOpenFile}},
+	{Name: "RookSemiOpenFile", Scores: []*Score{&Weights.RookSemiOpenFile}},
+	{Name: "QueenOpenFile", Scores: []*Score{&Weights.QueenOpenFile}},
+	{Name: "QueenSemiOpenFile", Scores: []*Score{&Weights.QueenSemiOpenFile}},
+	{Name: "BishopPair", Scores: []*Score{&Weights.BishopPair}},
+
+	{Name: "PawnShield", Scores: scoreRefs(Weights.PawnShield[:])},
+	{Name: "PawnStorm", Scores: scoreRefs(Weights.PawnStorm[:])},
+	{Name: "KingOpenFile", Scores: []*Score{&Weights.KingOpenFile}},
+	{Name: "KingSemiOpenFile", Scores: []*Score{&Weights.KingSemiOpenFile}},
+	{Name: "KingAttackTable", Values: intRefs(Weights.KingAttackTable[:])},
+}
+
+func scoreRefs(scores []Score) []*Score {
+	refs := make([]*Score, len(scores))
+	for i := range scores {
+		refs[i] = &scores[i]
+	}
+	return refs
+}
+
+func intRefs(values []int) []*int {
+	refs := make([]*int, len(values))
+	for i := range values {
+		refs[i] = &values[i]
+	}
+	return refs
+}
+
+// Get the number of single values of the parameter, counting the
+// middlegame and endgame value of a score separately.
+func (p *EvalParam) Size() int {
+	return 2*len(p.Scores) + len(p.Values)
+}
+
+// Get the i-th single value of the parameter. The values of a score come
+// as middlegame value followed by endgame value.
+func (p *EvalParam) Get(i int) int {
+	if p.Scores == nil {
+		return *p.Values[i]
+	}
+
+	score := *p.Scores[i/2]
+	if i%2 == 0 {
+		return score.MG()
+	}
+	return score.EG()
+}
+
+func (p *EvalParam) Set(i int, value int) {
+	if p.Scores == nil {
+		*p.Values[i] = value
+		return
+	}
+
+	score := p.Scores[i/2]
+	if i%2 == 0 {
+		*score = S(value, score.EG())
+	} else {
+		*score = S(score.MG(), value)
+	}
+}
+
+// SaveEvalParams writes all evaluation parameters to a file, one line per
+// parameter with its name followed by its values.
+func SaveEvalParams(path string) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	writer := bufio.NewWriter(file)
+
+	for i := range EvalParams {
+		param := &EvalParams[i]
+		values := make([]string, param.Size())
+
+		for j := range values {
+			values[j] = strconv.Itoa(param.Get(j))
+		}
+
+		fmt.Fprintf(writer, "%s %s\n", param.Name, strings.Join(values, " "))
+	}
+
+	return writer.Flush()
+}
+
+// LoadEvalParams reads evaluation parameters written by SaveEvalParams.
+// Parameters missing from the file keep their value, and nothing is
+// changed if the file contains an error.
+func LoadEvalParams(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	loaded := make(map[*EvalParam][]int)
+	scanner := bufio.NewScanner(file)
+
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		fields := strings.Fields(scanner.Text())
+
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+
+		param := findEvalParam(fields[0])
+		if param == nil {
+			return fmt.Errorf("line %d: unknown parameter %s", lineNum, fields[0])
+		}
+
+		if len(fields)-1 != param.Size() {
+			return fmt.Errorf("line %d: %s needs %d values, got %d", lineNum, param.Name, param.Size(), len(fields)-1)
+		}
+
+		values := make([]int, param.Size())
+		for i := range values {
+			values[i], err = strconv.Atoi(fields[i+1])
+			if err != nil {
+				return fmt.Errorf("line %d: %v", lineNum, err)
+			}
+		}
+
+		loaded[param] = values
+	}
+
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	for param, values := range loaded {
+		for i, value := range values {
+			param.Set(i, value)
+		}
+	}
+
+	initPieceSquareScores()
+
+	return nil
+}
+
+// ResetEvalParams restores the built-in evaluation weights.
+func ResetEvalParams() {
+	Weights = DefaultWeights
+	initPieceSquareScores()
+}
+
+func findEvalParam(name string) *EvalParam {
+	for i := range EvalParams {
+		if EvalParams[i].Name == name {
+			return &EvalParams[i]
+		}
+	}
+
+	return nil
+}
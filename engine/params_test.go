@@ -0,0 +1,105 @@
+package engine
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestEvalParamsRoundTrip(t *testing.T) {
+	defer ResetEvalParams()
+
+	pos := mustParseFen(t, "r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1")
+	defaultEval := EvalPosition(pos)
+
+	// Give every single value of the parameters its own number.
+	for i := range EvalParams {
+		param := &EvalParams[i]
+		for j := 0; j < param.Size(); j++ {
+			param.Set(j, 100*i+j-50)
+		}
+	}
+	initPieceSquareScores()
+
+	changed := Weights
+	changedEval := EvalPosition(pos)
+
+	if changedEval == defaultEval {
+		t.Fatalf("evaluation %d unchanged by the new weights", changedEval)
+	}
+
+	path := filepath.Join(t.TempDir(), "params.txt")
+	if err := SaveEvalParams(path); err != nil {
+		t.Fatal(err)
+	}
+
+	ResetEvalParams()
+	if Weights != DefaultWeights || EvalPosition(pos) != defaultEval {
+		t.Fatalf("built-in weights not restored")
+	}
+
+	if err := LoadEvalParams(path); err != nil {
+		t.Fatal(err)
+	}
+
+	if Weights != changed {
+		t.Errorf("loaded weights differ from the saved ones")
+	}
+
+	if eval := EvalPosition(pos); eval != changedEval {
+		t.Errorf("evaluation with the loaded weights %d, want %d", eval, changedEval)
+	}
+}
+
+func TestLoadEvalParams(t *testing.T) {
+	defer ResetEvalParams()
+
+	tests := []struct {
+		name string
+		file string
+		err  string
+	}{
+		{"unknown parameter", "BishopPair 30 50\nKnightPair 10 10\n", "line 2: unknown parameter KnightPair"},
+		{"missing value", "# comment\nBishopPair 30\n", "line 2: BishopPair needs 2 values, got 1"},
+		{"too many values", "RookOpenFile 1 2 3\n", "line 1: RookOpenFile needs 2 values, got 3"},
+		{"bad number", "\nBishopPair 30 x\n", "line 2: strconv.Atoi"},
+	}
+
+	dir := t.TempDir()
+
+	for _, test := range tests {
+		path := filepath.Join(dir, strings.ReplaceAll(test.name, " ", "_"))
+		if err := os.WriteFile(path, []byte(test.file), 0o644); err != nil {
+			t.Fatal(err)
+		}
+
+		err := LoadEvalParams(path)
+		if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("%s: error %v, want %q", test.name, err, test.err)
+		}
+
+		// Nothing is loaded from a file with an error.
+		if Weights != DefaultWeights {
+			t.Errorf("%s: weights changed by a file with an error", test.name)
+			ResetEvalParams()
+		}
+	}
+
+	// Parameters missing from the file keep their value.
+	path := filepath.Join(dir, "partial")
+	if err := os.WriteFile(path, []byte("# bishops\n\nBishopPair 31 57\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := LoadEvalParams(path); err != nil {
+		t.Fatal(err)
+	}
+
+	want := DefaultWeights
+	want.BishopPair = S(31, 57)
+
+	if Weights != want {
+		t.Errorf("partial file changed more than BishopPair to S(31, 57)")
+	}
+}
@@ -0,0 +1,144 @@
+package engine
+
+// The number of entries of a pawn hash table.
+const PawnTableSize = 1 << 14
+
+// PawnEntry caches the evaluation of a pawn structure. Only terms that
+// depend on nothing but the pawns can be cached, the passed pawns are kept
+// so the terms depending on the other pieces can be added afterwards.
+type PawnEntry struct {
+	Key    uint64
+	Score  Score
+	Passed [2]Bitboard
+}
+
+// PawnTable is a hash table of pawn structures, indexed by the pawn hash
+// of the position. Each search thread has its own table.
+type PawnTable struct {
+	entries [PawnTableSize]PawnEntry
+}
+
+func (pt *PawnTable) Clear() {
+	for i := range pt.entries {
+		pt.entries[i] = PawnEntry{}
+	}
+}
+
+// Get the evaluation of the pawn structure of the position, from the pawn
+// table of the position if it has one. When tracing, the pawn structure
+// is always evaluated to record its terms.
+func probePawnStructure(pos *BoardStruct, trace *EvalTrace) PawnEntry {
+	if pos.PawnTable == nil || trace != nil {
+		return evalPawnStructure(pos, trace)
+	}
+
+	entry := &pos.PawnTable.entries[pos.PawnHash%PawnTableSize]
+
+	if entry.Key != pos.PawnHash {
+		*entry = evalPawnStructure(pos, nil)
+	}
+
+	return *entry
+}
+
+func evalPawnStructure(pos *BoardStruct, trace *EvalTrace) PawnEntry {
+	entry := PawnEntry{Key: pos.PawnHash}
+
+	white, whitePassed := evalPawns(pos, White, trace)
+	black, blackPassed := evalPawns(pos, Black, trace)
+
+	entry.Score = white - black
+	entry.Passed = [2]Bitboard{whitePassed, blackPassed}
+
+	return entry
+}
+
+// Sum up the pawn structure terms of one side and find its passed pawns.
+func evalPawns(pos *BoardStruct, side uint8, trace *EvalTrace) (Score, Bitboard) {
+	score := S(0, 0)
+	passed := Bitboard(0)
+
+	them := side ^ 1
+	ownPawns := pos.Pawns[side]
+	enemyPawns := pos.Pawns[them]
+
+	passedMask := &WhitePassedMask
+	stopOffset := 8
+	if side == Black {
+		passedMask = &BlackPassedMask
+		stopOffset = -8
+	}
+
+	pawnBB := ownPawns
+
+	for pawnBB != 0 {
+		sq := pawnBB.PopBit()
+		file := FileOf(sq)
+		relRank := relativeRank(side, sq)
+
+		ahead := forwardRanks(side, sq)
+		neighbours := IsolatedMask[sq] & ownPawns
+		sentries := passedMask[sq] & enemyPawns
+
+		if neighbours == 0 {
+			score += trace.add(side, TermPawnStructure, Weights.IsolatedPawnPenalty)
+		} else if neighbours&^ahead == 0 && PawnAttacks[them][sq+stopOffset]&enemyPawns != 0 {
+			// All neighbours are ahead of the pawn, and it can't advance
+			// to them without being captured.
+			score += trace.add(side, TermPawnStructure, Weights.BackwardPawnPenalty)
+		}
+
+		if (FileBBMask[file] & ownPawns).CountBits() >= 2 {
+			score += trace.add(side, TermPawnStructure, Weights.DoublePawnPenalty)
+		}
+
+		if PawnAttacks[side][sq]&ownPawns != 0 {
+			score += trace.add(side, TermPawnStructure, Weights.PawnConnected[relRank])
+		}
+
+		if neighbours&RankBBMask[RankOf(sq)] != 0 {
+			score += trace.add(side, TermPawnStructure, Weights.PawnPhalanx[relRank])
+		}
+
+		if sentries == 0 {
+			passed |= SetMask[sq]
+			score += trace.add(side, TermPassedPawns, Weights.PawnPassed[relRank])
+		} else if sentries&FileBBMask[file] == 0 && (neighbours&^ahead).CountBits() >= sentries.CountBits() {
+			// Nothing blocks the file, and the enemy pawns guarding the
+			// way can all be traded off by the pawns next to or behind it.
+			score += trace.add(side, TermPawnStructure, Weights.PawnCandidate[relRank])
+		}
+	}
+
+	return score, passed
+}
+
+// Sum up the terms of one side's passed pawns that depend on the other
+// pieces: how close the kings are to the square in front of the pawn, and
+// whether its path to promotion is free.
+func evalPassedPawns(pos *BoardStruct, side uint8, passed Bitboard, trace *EvalTrace) Score {
+	score := S(0, 0)
+
+	ownKingSq := pos.Pieces[AllPieces[side][King]].Msb()
+	enemyKingSq := pos.Pieces[AllPieces[side^1][King]].Msb()
+
+	stopOffset := 8
+	if side == Black {
+		stopOffset = -8
+	}
+
+	for passed != 0 {
+		sq := passed.PopBit()
+		relRank := relativeRank(side, sq)
+		stop := sq + stopOffset
+
+		score += trace.add(side, TermPassedPawns, Weights.PassedOwnKingDistance[relRank]*Score(SquareDistance(ownKingSq, stop)))
+		score += trace.add(side, TermPassedPawns, Weights.PassedEnemyKingDistance[relRank]*Score(SquareDistance(enemyKingSq, stop)))
+
+		if FileBBMask[FileOf(sq)]&forwardRanks(side, sq)&pos.Sides[Both] == 0 {
+			score += trace.add(side, TermPassedPawns, Weights.PassedFreePath[relRank])
+		}
+	}
+
+	return score
+}
@@ -0,0 +1,35 @@
+package engine
+
+import "testing"
+
+func TestPawnHash(t *testing.T) {
+	walkLines(t, func(pos *BoardStruct, step string) {
+		if key := GeneratePawnKey(pos); pos.PawnHash != key {
+			t.Fatalf("%s: pawn hash %016x, want %016x", step, pos.PawnHash, key)
+		}
+
+		for side := White; side <= Black; side++ {
+			if pos.Pawns[side] != pos.Pieces[AllPieces[side][Pawn]] {
+				t.Fatalf("%s: pawns of side %d out of date", step, side)
+			}
+		}
+	})
+}
+
+func TestPawnTable(t *testing.T) {
+	var table PawnTable
+
+	walkLines(t, func(pos *BoardStruct, step string) {
+		want := evalPawnStructure(pos, nil)
+
+		// The first probe fills the entry, the second one reads it back.
+		pos.PawnTable = &table
+		first := probePawnStructure(pos, nil)
+		second := probePawnStructure(pos, nil)
+		pos.PawnTable = nil
+
+		if first != want || second != want {
+			t.Fatalf("%s: pawn table entries %v and %v, want %v", step, first, second, want)
+		}
+	})
+}
@@ -27,14 +27,37 @@ func Perft(depth int, pos *BoardStruct) {
 	}
 }
 
-func PerftTest(depth int, pos *BoardStruct) {
+// PerftLegal counts the leaf nodes with the legal move generator. The moves
+// at the last ply don't need to be made, since every one of them is legal.
+func PerftLegal(depth int, pos *BoardStruct) {
+	var list MoveList
+
+	GenerateLegalMoveList(pos, &list)
+
+	if depth == 1 {
+		leafNodes += int64(list.Count)
+		return
+	}
+
+	for moveNum := 0; moveNum < list.Count; moveNum++ {
+		pos.DoMove(list.Moves[moveNum])
+		PerftLegal(depth-1, pos)
+		pos.UndoMove()
+	}
+}
+
+func PerftTest(depth int, pos *BoardStruct, legal bool) {
 	fmt.Printf("\nStarting Test To Depth:%d\n", depth)
 	leafNodes = 0
 
 	start := time.Now().UnixMilli()
 
 	var list MoveList
-	GenerateAllMoves(pos, &list, true)
+	if legal {
+		GenerateLegalMoveList(pos, &list)
+	} else {
+		GenerateAllMoves(pos, &list, true)
+	}
 
 	for moveNum := 0; moveNum < list.Count; moveNum++ {
 		move := list.Moves[moveNum]
@@ -42,7 +65,11 @@ func PerftTest(depth int, pos *BoardStruct) {
 			continue
 		}
 		var cumnodes int64 = leafNodes
-		Perft(depth-1, pos)
+		if legal && depth > 1 {
+			PerftLegal(depth-1, pos)
+		} else {
+			Perft(depth-1, pos)
+		}
 		pos.UndoMove()
 		var oldnodes int64 = leafNodes - cumnodes
 		fmt.Printf("move %d > %s : %d\n", moveNum+1, move.String(), oldnodes)
@@ -57,3 +84,77 @@ func PerftTest(depth int, pos *BoardStruct) {
 	fmt.Printf("Nodes searched : %d\n", leafNodes)
 	fmt.Printf("Nodes/second : %d\n\n", int64(float64(leafNodes)/totalTimeInS))
 }
+
+// PerftCheck walks the game tree to the depth and compares the legal move
+// generator against the pseudo-legal one filtered by making the moves, at
+// every node. Each position where they disagree is printed with the moves
+// leading to it. Returns the number of such positions.
+func PerftCheck(depth int, pos *BoardStruct) int {
+	return perftCheck(depth, pos, nil)
+}
+
+func perftCheck(depth int, pos *BoardStruct, path []Move) int {
+	var pseudo, legal MoveList
+
+	GenerateAllMoves(pos, &pseudo, true)
+	GenerateLegalMoveList(pos, &legal)
+
+	mismatches := 0
+	count := 0
+
+	for moveNum := 0; moveNum < pseudo.Count; moveNum++ {
+		move := pseudo.Moves[moveNum]
+
+		if !pos.DoMove(move) {
+			if pos.IsLegal(move) {
+				fmt.Printf("%s: %s is illegal but IsLegal accepts it\n", pathString(path), move.String())
+				mismatches++
+			}
+			continue
+		}
+		pos.UndoMove()
+		count++
+
+		if !legal.Contains(move) || !pos.IsLegal(move) {
+			fmt.Printf("%s: legal move %s is missing\n", pathString(path), move.String())
+			mismatches++
+		}
+	}
+
+	if count != legal.Count {
+		fmt.Printf("%s: %d legal moves, but %d generated\n", pathString(path), count, legal.Count)
+		mismatches++
+	}
+
+	if depth <= 1 {
+		return mismatches
+	}
+
+	for moveNum := 0; moveNum < pseudo.Count; moveNum++ {
+		move := pseudo.Moves[moveNum]
+
+		if !pos.DoMove(move) {
+			continue
+		}
+		mismatches += perftCheck(depth-1, pos, append(path, move))
+		pos.UndoMove()
+	}
+
+	return mismatches
+}
+
+func pathString(path []Move) string {
+	if len(path) == 0 {
+		return "root"
+	}
+
+	str := ""
+	for i, move := range path {
+		if i > 0 {
+			str += " "
+		}
+		str += move.String()
+	}
+
+	return str
+}
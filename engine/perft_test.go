@@ -0,0 +1,85 @@
+package engine
+
+import "testing"
+
+// The standard perft positions with their node counts by depth, from
+// https://www.chessprogramming.org/Perft_Results.
+var perftPositions = []struct {
+	name  string
+	fen   string
+	nodes []int64
+}{
+	{"startpos", FENStart, []int64{20, 400, 8902, 197281}},
+	{"kiwipete", "r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1", []int64{48, 2039, 97862}},
+	{"position 3", "8/2p5/3p4/KP5r/1R3p1k/8/4P1P1/8 w - - 0 1", []int64{14, 191, 2812, 43238}},
+	{"position 4", "r3k2r/Pppp1ppp/1b3nbN/nP6/BBP1P3/q4N2/Pp1P2PP/R2Q1RK1 w kq - 0 1", []int64{6, 264, 9467}},
+	{"position 5", "rnbq1k1r/pp1Pbppp/2p5/8/2B5/8/PPP1NnPP/RNBQK2R w KQ - 1 8", []int64{44, 1486, 62379}},
+}
+
+func TestPerft(t *testing.T) {
+	for _, test := range perftPositions {
+		for depth, want := range test.nodes {
+			pos := mustParseFen(t, test.fen)
+
+			leafNodes = 0
+			Perft(depth+1, pos)
+			if leafNodes != want {
+				t.Errorf("%s: pseudo-legal perft(%d) = %d, want %d", test.name, depth+1, leafNodes, want)
+			}
+
+			leafNodes = 0
+			PerftLegal(depth+1, pos)
+			if leafNodes != want {
+				t.Errorf("%s: legal perft(%d) = %d, want %d", test.name, depth+1, leafNodes, want)
+			}
+		}
+	}
+}
+
+func TestPerftCheck(t *testing.T) {
+	for _, test := range perftPositions {
+		if mismatches := PerftCheck(2, mustParseFen(t, test.fen)); mismatches != 0 {
+			t.Errorf("%s: %d positions where the legal generator disagrees", test.name, mismatches)
+		}
+	}
+}
+
+// IsPseudoLegal and IsLegal have to accept exactly the moves the move
+// generators generate, with the same move types and flags.
+func TestIsLegal(t *testing.T) {
+	step := 0
+
+	walkLines(t, func(pos *BoardStruct, name string) {
+		if step++; step%20 != 1 {
+			return
+		}
+
+		var pseudo MoveList
+		GenerateAllMoves(pos, &pseudo, true)
+
+		var legal MoveList
+		GenerateLegalMoveList(pos, &legal)
+
+		pieces := pos.Sides[pos.SideToMove]
+
+		for pieces != 0 {
+			from := pieces.PopBit()
+
+			for to := 0; to < 64; to++ {
+				for moveType := Quiet; moveType <= Promotion; moveType++ {
+					for flag := uint8(0); flag < 4; flag++ {
+						move := NewMove(from, to, moveType, flag)
+
+						if got, want := pos.IsPseudoLegal(move), pseudo.Contains(move); got != want {
+							t.Fatalf("%s: IsPseudoLegal(%v type %d flag %d) = %t, want %t", name, move, moveType, flag, got, want)
+						}
+
+						if got, want := pos.IsLegal(move), legal.Contains(move); got != want {
+							t.Fatalf("%s: IsLegal(%v type %d flag %d) = %t, want %t", name, move, moveType, flag, got, want)
+						}
+					}
+				}
+			}
+		}
+	})
+}
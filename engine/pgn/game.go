@@ -0,0 +1,147 @@
+// Package pgn reads and writes chess games in Portable Game Notation.
+//
+// The moves are checked against the legal moves of the positions, so the
+// engine's tables must be initialized before games are read or written.
+package pgn
+
+import (
+	"ping/engine"
+)
+
+// The results a game can end with, "*" is a game still going on or
+// whose result is unknown.
+const (
+	WhiteWins  = "1-0"
+	BlackWins  = "0-1"
+	Draw       = "1/2-1/2"
+	NoResult   = "*"
+	DefaultTag = "?"
+)
+
+// The Seven Tag Roster, the tags every game has in export format, in
+// the order they are written.
+var SevenTagRoster = []string{"Event", "Site", "Date", "Round", "White", "Black", "Result"}
+
+type Tag struct {
+	Name  string
+	Value string
+}
+
+// Game is a game as a tree of moves. The main line follows the first
+// child of each node, the other children are the variations.
+type Game struct {
+	Tags []Tag
+
+	// The root stands for the starting position, it has no move. Its
+	// comment is the comment in front of the first move.
+	Root *Node
+
+	Result string
+}
+
+// Node is a position of the game, reached by the move from the position
+// of its parent.
+type Node struct {
+	Parent   *Node
+	Children []*Node
+
+	Move engine.Move
+
+	// The comment in front of the move, only kept for the first move of a
+	// variation, and the comment after it.
+	StartingComment string
+	Comment         string
+
+	// Numeric Annotation Glyphs, move suffixes such as "!?" are turned
+	// into their NAGs.
+	NAGs []int
+}
+
+// NewGame creates a game without moves from the standard starting
+// position.
+func NewGame() *Game {
+	return &Game{Root: &Node{}, Result: NoResult}
+}
+
+// Tag gets the value of the tag, or "" if the game doesn't have it.
+func (game *Game) Tag(name string) string {
+	for _, tag := range game.Tags {
+		if tag.Name == name {
+			return tag.Value
+		}
+	}
+
+	return ""
+}
+
+// SetTag sets the value of the tag, adding it if the game doesn't have it.
+func (game *Game) SetTag(name string, value string) {
+	for i := range game.Tags {
+		if game.Tags[i].Name == name {
+			game.Tags[i].Value = value
+			return
+		}
+	}
+
+	game.Tags = append(game.Tags, Tag{name, value})
+}
+
+// StartPosition sets up the starting position of the game, given by its
+// FEN tag or the standard starting position.
+func (game *Game) StartPosition() (*engine.BoardStruct, error) {
+	fen := game.Tag("FEN")
+	if fen == "" {
+		fen = engine.FENStart
+	}
+
+	pos := new(engine.BoardStruct)
+	if err := pos.ParseFen(fen); err != nil {
+		return nil, err
+	}
+
+	return pos, nil
+}
+
+// MainLine gets the moves of the main line.
+func (game *Game) MainLine() []engine.Move {
+	var moves []engine.Move
+
+	for node := game.Root; len(node.Children) > 0; node = node.Children[0] {
+		moves = append(moves, node.Children[0].Move)
+	}
+
+	return moves
+}
+
+// AddMove gets the child of the node reached by the move, adding it as
+// the last variation if there is none yet.
+func (node *Node) AddMove(move engine.Move) *Node {
+	for _, child := range node.Children {
+		if child.Move.Equal(move) {
+			return child
+		}
+	}
+
+	return node.addChild(move)
+}
+
+func (node *Node) addChild(move engine.Move) *Node {
+	child := &Node{Parent: node, Move: move}
+	node.Children = append(node.Children, child)
+
+	return child
+}
+
+// The NAGs of the traditional move suffixes.
+var suffixNAGs = map[string]int{
+	"!":  1,
+	"?":  2,
+	"!!": 3,
+	"??": 4,
+	"!?": 5,
+	"?!": 6,
+}
+
+func isResult(str string) bool {
+	return str == WhiteWins || str == BlackWins || str == Draw || str == NoResult
+}
@@ -0,0 +1,170 @@
+package pgn
+
+import (
+	"io"
+	"os"
+	"strings"
+	"testing"
+
+	"ping/engine"
+)
+
+func TestMain(m *testing.M) {
+	engine.InitBitMasks()
+	engine.InitHashKeys()
+	engine.InitTables()
+	engine.InitEvalMasks()
+	engine.InitMvvLva()
+	engine.InitMagic()
+	engine.InitLineMasks()
+	engine.InitReductions()
+
+	os.Exit(m.Run())
+}
+
+const annotatedGame = `% An escaped line
+[Event "The \"Quoted\" Open"]
+[Site "C:\\games"]
+[White "Alpha"]
+[Black "Beta"]
+[Result "1-0"]
+[ECO "C60"]
+
+{Before the first move} 1. e4 e5 2. Nf3 $1 Nc6 3. Bb5!? a6 {Morphy's defence}
+(3... Nf6 4. O-O (4. d3 {the quiet line} Bc5) 4... Nxe4) ({Otherwise} 3... f5?!)
+4. Ba4 ; a rest of line comment
+Nf6 5. O-O Be7 6. Re1 b5 7. Bb3 d6 8. c3 O-O 9. h3 Nb8 10. d4 Nbd7 11. Nbd2 Bb7
+12. Bc2 Re8 13. Nf1 Bf8 14. Ng3 g6 15. a4 c5 16. d5 c4 17. Bg5 h6 18. Be3 Nc5
+19. Qd2 h5 20. Bg5 Be7 21. Nh2 1-0
+`
+
+func readOne(t *testing.T, text string) *Game {
+	t.Helper()
+
+	games, err := ReadAll(strings.NewReader(text))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(games) != 1 {
+		t.Fatalf("read %d games, want 1", len(games))
+	}
+
+	return games[0]
+}
+
+func writeString(t *testing.T, game *Game) string {
+	t.Helper()
+
+	var out strings.Builder
+	if err := Write(&out, game); err != nil {
+		t.Fatal(err)
+	}
+
+	return out.String()
+}
+
+func TestRoundTrip(t *testing.T) {
+	game := readOne(t, annotatedGame)
+
+	if got := game.Tag("Event"); got != `The "Quoted" Open` {
+		t.Errorf("Event = %q", got)
+	}
+	if got := game.Tag("Site"); got != `C:\games` {
+		t.Errorf("Site = %q", got)
+	}
+	if game.Result != WhiteWins {
+		t.Errorf("Result = %q, want %q", game.Result, WhiteWins)
+	}
+	if len(game.MainLine()) != 41 {
+		t.Errorf("main line has %d moves, want 41", len(game.MainLine()))
+	}
+	if game.Root.Comment != "Before the first move" {
+		t.Errorf("game comment = %q", game.Root.Comment)
+	}
+
+	// 3. Bb5 with its suffix turned into a NAG, and 3... a6 with the two
+	// variations replacing it.
+	bb5 := game.Root.Children[0].Children[0].Children[0].Children[0].Children[0]
+	if len(bb5.NAGs) != 1 || bb5.NAGs[0] != 5 {
+		t.Errorf("NAGs of 3. Bb5 = %v, want [5]", bb5.NAGs)
+	}
+
+	if len(bb5.Children) != 3 {
+		t.Fatalf("3. Bb5 has %d replies, want 3", len(bb5.Children))
+	}
+
+	nf6 := bb5.Children[1]
+	if len(nf6.Children) != 2 || len(nf6.Children[1].Children) != 1 {
+		t.Errorf("the nested variation 4. d3 Bc5 is missing")
+	}
+	if bb5.Children[2].StartingComment != "Otherwise" {
+		t.Errorf("starting comment = %q", bb5.Children[2].StartingComment)
+	}
+
+	written := writeString(t, game)
+
+	for _, line := range strings.Split(written, "\n") {
+		if len(line) > maxLineLength {
+			t.Errorf("line longer than %d characters: %q", maxLineLength, line)
+		}
+	}
+
+	for _, want := range []string{
+		`[Event "The \"Quoted\" Open"]`,
+		`[Site "C:\\games"]`,
+		`[Date "????.??.??"]`,
+		"3. Bb5 $5 a6 {Morphy's defence}",
+		"(3... Nf6 4. O-O (4. d3 {the quiet line} 4... Bc5) 4... Nxe4)",
+		"({Otherwise}",
+		"3... f5 $6)",
+	} {
+		if !strings.Contains(written, want) {
+			t.Errorf("written game doesn't contain %q:\n%s", want, written)
+		}
+	}
+
+	if again := writeString(t, readOne(t, written)); again != written {
+		t.Errorf("game changed when read back:\n%s\nwant\n%s", again, written)
+	}
+}
+
+func TestFENGame(t *testing.T) {
+	game := readOne(t, `[SetUp "1"]
+[FEN "4k3/P7/8/8/8/8/8/4K3 b - - 0 60"]
+
+60... Kd7 61. a8=Q Kc7 *`)
+
+	written := writeString(t, game)
+	if !strings.Contains(written, "60... Kd7 61. a8=Q Kc7 *") {
+		t.Errorf("written game:\n%s", written)
+	}
+}
+
+func TestIllegalMove(t *testing.T) {
+	reader := NewReader(strings.NewReader(`[Event "Broken"]
+
+1. e4 e5 2. Ke3 Nc6 1-0
+
+[Event "Fine"]
+
+1. d4 d5 0-1
+`))
+
+	if _, err := reader.Next(); err == nil || !strings.Contains(err.Error(), "line 3: illegal move Ke3") {
+		t.Errorf("Next() error = %v, want an illegal move on line 3", err)
+	}
+
+	// Reading goes on with the next game.
+	game, err := reader.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if game.Tag("Event") != "Fine" || len(game.MainLine()) != 2 {
+		t.Errorf("read %q with %d moves after the broken game", game.Tag("Event"), len(game.MainLine()))
+	}
+
+	if _, err := reader.Next(); err != io.EOF {
+		t.Errorf("Next() at the end = %v, want io.EOF", err)
+	}
+}
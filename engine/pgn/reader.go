@@ -0,0 +1,436 @@
+package pgn
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"ping/engine"
+)
+
+// The longest line of moves that can be followed, the board keeps a
+// limited history.
+const maxPlies = 1024
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenSymbol
+	tokenString
+	tokenPeriod
+	tokenNAG
+	tokenSuffix
+	tokenComment
+	tokenOpenBracket
+	tokenCloseBracket
+	tokenOpenParen
+	tokenCloseParen
+)
+
+type token struct {
+	kind  tokenKind
+	value string
+	line  int
+}
+
+// Reader reads the games of a PGN file one after the other.
+type Reader struct {
+	reader *bufio.Reader
+
+	line      int
+	lineStart bool
+
+	peeked *token
+}
+
+func NewReader(reader io.Reader) *Reader {
+	return &Reader{reader: bufio.NewReader(reader), line: 1, lineStart: true}
+}
+
+// ReadAll reads all games of the PGN file.
+func ReadAll(reader io.Reader) ([]*Game, error) {
+	var games []*Game
+
+	pgnReader := NewReader(reader)
+
+	for {
+		game, err := pgnReader.Next()
+		if err == io.EOF {
+			return games, nil
+		} else if err != nil {
+			return games, err
+		}
+
+		games = append(games, game)
+	}
+}
+
+// Next reads the next game, io.EOF is returned after the last one. If a
+// game can't be read, the error tells where, and the reader moves on to
+// the following game so reading can go on.
+func (r *Reader) Next() (*Game, error) {
+	tok, err := r.peek()
+	if err != nil {
+		r.skipGame(true)
+		return nil, err
+	} else if tok.kind == tokenEOF {
+		return nil, io.EOF
+	}
+
+	game := NewGame()
+
+	if err := r.readTags(game); err != nil {
+		r.skipGame(true)
+		return nil, err
+	}
+
+	if err := r.readMovetext(game); err != nil {
+		r.skipGame(false)
+		return nil, err
+	}
+
+	return game, nil
+}
+
+func (r *Reader) readTags(game *Game) error {
+	for {
+		tok, err := r.peek()
+		if err != nil {
+			return err
+		} else if tok.kind != tokenOpenBracket {
+			return nil
+		}
+
+		r.peeked = nil
+
+		name, err := r.expect(tokenSymbol, "tag name")
+		if err != nil {
+			return err
+		}
+
+		value, err := r.expect(tokenString, "tag value")
+		if err != nil {
+			return err
+		}
+
+		if _, err := r.expect(tokenCloseBracket, "]"); err != nil {
+			return err
+		}
+
+		game.Tags = append(game.Tags, Tag{name.value, value.value})
+	}
+}
+
+// Read the moves of the game up to its result. Variations are followed
+// on the board by taking back the move they replace, and when they end
+// the moves of the variation are taken back and the replaced move is
+// made again.
+func (r *Reader) readMovetext(game *Game) error {
+	pos, err := game.StartPosition()
+	if err != nil {
+		return fmt.Errorf("game starting on line %d: invalid FEN: %v", r.line, err)
+	}
+
+	node := game.Root
+	var variations []*Node
+
+	// A comment in front of the first move of a variation.
+	startingComment := ""
+	variationStart := false
+
+	for {
+		tok, err := r.next()
+		if err != nil {
+			return err
+		}
+
+		switch tok.kind {
+		case tokenEOF:
+			return nil
+		case tokenOpenBracket:
+			// The result is missing, the tags of the next game follow.
+			r.peeked = &tok
+			return nil
+		case tokenPeriod:
+		case tokenNAG:
+			nag, err := strconv.Atoi(tok.value)
+			if err != nil || node == game.Root {
+				return fmt.Errorf("line %d: misplaced NAG $%s", tok.line, tok.value)
+			}
+
+			node.NAGs = append(node.NAGs, nag)
+		case tokenSuffix:
+			nag, ok := suffixNAGs[tok.value]
+			if !ok || node == game.Root {
+				return fmt.Errorf("line %d: invalid move suffix %s", tok.line, tok.value)
+			}
+
+			node.NAGs = append(node.NAGs, nag)
+		case tokenComment:
+			if variationStart {
+				startingComment = joinComments(startingComment, tok.value)
+			} else {
+				node.Comment = joinComments(node.Comment, tok.value)
+			}
+		case tokenOpenParen:
+			if node == game.Root {
+				return fmt.Errorf("line %d: variation without a move to replace", tok.line)
+			}
+
+			variations = append(variations, node)
+			pos.UndoMove()
+			node = node.Parent
+			variationStart = true
+		case tokenCloseParen:
+			if len(variations) == 0 {
+				return fmt.Errorf("line %d: unmatched )", tok.line)
+			}
+
+			replaced := variations[len(variations)-1]
+			variations = variations[:len(variations)-1]
+
+			for ; node != replaced.Parent; node = node.Parent {
+				pos.UndoMove()
+			}
+
+			pos.DoMove(replaced.Move)
+			node = replaced
+			variationStart = false
+		case tokenSymbol:
+			if isResult(tok.value) {
+				if len(variations) != 0 {
+					return fmt.Errorf("line %d: result inside a variation", tok.line)
+				}
+
+				game.Result = tok.value
+				return nil
+			}
+
+			if strings.Trim(tok.value, "0123456789") == "" {
+				// A move number.
+				continue
+			}
+
+			move := engine.ParseSAN(pos, tok.value)
+			if move == engine.NoMove {
+				return fmt.Errorf("line %d: illegal move %s", tok.line, tok.value)
+			}
+
+			if pos.HistoryPly >= maxPlies {
+				return fmt.Errorf("line %d: line of moves longer than %d plies", tok.line, maxPlies)
+			}
+
+			node = node.addChild(move)
+			pos.DoMove(move)
+
+			if variationStart {
+				node.StartingComment = startingComment
+				startingComment = ""
+				variationStart = false
+			}
+		default:
+			return fmt.Errorf("line %d: unexpected %q in movetext", tok.line, tok.value)
+		}
+	}
+}
+
+func joinComments(comment string, next string) string {
+	if comment == "" {
+		return next
+	}
+
+	return comment + " " + next
+}
+
+// Skip the rest of the game after an error, up to its result or the tags
+// of the next game. A tag only starts the next game if it doesn't follow
+// another tag, so the rest of the tags of a game with a broken tag are
+// skipped too.
+func (r *Reader) skipGame(inTags bool) {
+	previous := tokenSymbol
+	if inTags {
+		previous = tokenCloseBracket
+	}
+
+	for {
+		tok, err := r.next()
+		if err != nil {
+			continue
+		}
+
+		switch {
+		case tok.kind == tokenEOF:
+			return
+		case tok.kind == tokenSymbol && isResult(tok.value):
+			return
+		case tok.kind == tokenOpenBracket && previous != tokenCloseBracket:
+			r.peeked = &tok
+			return
+		}
+
+		previous = tok.kind
+	}
+}
+
+func (r *Reader) expect(kind tokenKind, what string) (token, error) {
+	tok, err := r.next()
+	if err != nil {
+		return tok, err
+	}
+
+	if tok.kind != kind {
+		return tok, fmt.Errorf("line %d: expected %s, got %q", tok.line, what, tok.value)
+	}
+
+	return tok, nil
+}
+
+func (r *Reader) peek() (token, error) {
+	if r.peeked == nil {
+		tok, err := r.next()
+		if err != nil {
+			return tok, err
+		}
+
+		r.peeked = &tok
+	}
+
+	return *r.peeked, nil
+}
+
+// Get the next token of the file.
+func (r *Reader) next() (token, error) {
+	if r.peeked != nil {
+		tok := *r.peeked
+		r.peeked = nil
+		return tok, nil
+	}
+
+	for {
+		char, err := r.reader.ReadByte()
+		if err != nil {
+			return token{kind: tokenEOF, line: r.line}, nil
+		}
+
+		lineStart := r.lineStart
+		r.lineStart = char == '\n'
+
+		if char == '\n' {
+			r.line++
+			continue
+		}
+
+		// A line starting with '%' is ignored.
+		if lineStart && char == '%' {
+			r.readUntil('\n')
+			continue
+		}
+
+		tok := token{value: string(char), line: r.line}
+
+		switch {
+		case char == ' ' || char == '\t' || char == '\r':
+			continue
+		case char == '[':
+			tok.kind = tokenOpenBracket
+		case char == ']':
+			tok.kind = tokenCloseBracket
+		case char == '(':
+			tok.kind = tokenOpenParen
+		case char == ')':
+			tok.kind = tokenCloseParen
+		case char == '.':
+			tok.kind = tokenPeriod
+		case char == '*':
+			tok.kind = tokenSymbol
+		case char == '"':
+			tok.kind = tokenString
+			tok.value, err = r.readString()
+		case char == '{':
+			tok.kind = tokenComment
+			tok.value = strings.Join(strings.Fields(r.readUntil('}')), " ")
+		case char == ';':
+			tok.kind = tokenComment
+			tok.value = strings.TrimSpace(r.readUntil('\n'))
+		case char == '$':
+			tok.kind = tokenNAG
+			tok.value = r.readWhile(isDigit)
+		case char == '!' || char == '?':
+			tok.kind = tokenSuffix
+			tok.value += r.readWhile(func(char byte) bool { return char == '!' || char == '?' })
+		case isSymbolChar(char):
+			tok.kind = tokenSymbol
+			tok.value += r.readWhile(isSymbolChar)
+		default:
+			return tok, fmt.Errorf("line %d: unexpected character %q", r.line, char)
+		}
+
+		return tok, err
+	}
+}
+
+// Read a string token after its opening quote, with \" and \\ escaped.
+func (r *Reader) readString() (string, error) {
+	var str strings.Builder
+
+	for {
+		char, err := r.reader.ReadByte()
+		if err != nil || char == '\n' {
+			r.lineStart = char == '\n'
+			if char == '\n' {
+				r.line++
+			}
+
+			return str.String(), fmt.Errorf("line %d: unterminated string", r.line)
+		}
+
+		switch char {
+		case '"':
+			return str.String(), nil
+		case '\\':
+			if next, err := r.reader.ReadByte(); err == nil {
+				char = next
+			}
+		}
+
+		str.WriteByte(char)
+	}
+}
+
+// Read up to and including the delimiter, which isn't returned.
+func (r *Reader) readUntil(delim byte) string {
+	str, _ := r.reader.ReadString(delim)
+	r.line += strings.Count(str, "\n")
+	r.lineStart = strings.HasSuffix(str, "\n")
+
+	return strings.TrimSuffix(str, string(delim))
+}
+
+func (r *Reader) readWhile(accept func(byte) bool) string {
+	var str strings.Builder
+
+	for {
+		char, err := r.reader.ReadByte()
+		if err != nil {
+			return str.String()
+		}
+
+		if !accept(char) {
+			r.reader.UnreadByte()
+			return str.String()
+		}
+
+		str.WriteByte(char)
+	}
+}
+
+func isDigit(char byte) bool {
+	return char >= '0' && char <= '9'
+}
+
+func isSymbolChar(char byte) bool {
+	return char >= 'a' && char <= 'z' || char >= 'A' && char <= 'Z' || isDigit(char) || strings.IndexByte("_+#=:-/", char) >= 0
+}
@@ -0,0 +1,208 @@
+package pgn
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"ping/engine"
+)
+
+// The longest line of movetext in export format.
+const maxLineLength = 79
+
+// Write writes the game in export format: the Seven Tag Roster first,
+// then the other tags sorted by name, and the movetext wrapped into lines
+// of at most 79 characters, followed by an empty line.
+func Write(writer io.Writer, game *Game) error {
+	out := bufio.NewWriter(writer)
+
+	for _, tag := range exportTags(game) {
+		value := strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(tag.Value)
+		fmt.Fprintf(out, "[%s \"%s\"]\n", tag.Name, value)
+	}
+
+	out.WriteString("\n")
+
+	pos, err := game.StartPosition()
+	if err != nil {
+		return err
+	}
+
+	movetext := movetextWriter{out: out, pos: pos}
+
+	movetext.comment(game.Root.Comment)
+	movetext.line(game.Root, true)
+	movetext.word(gameResult(game))
+
+	out.WriteString("\n\n")
+
+	return out.Flush()
+}
+
+func gameResult(game *Game) string {
+	if game.Result == "" {
+		return NoResult
+	}
+
+	return game.Result
+}
+
+// Get the tags in the order of export format, with the Seven Tag Roster
+// completed and the result tag matching the result of the game.
+func exportTags(game *Game) []Tag {
+	var tags, others []Tag
+
+	for _, name := range SevenTagRoster {
+		value := game.Tag(name)
+
+		switch {
+		case name == "Result":
+			value = gameResult(game)
+		case name == "Date" && value == "":
+			value = "????.??.??"
+		case value == "":
+			value = DefaultTag
+		}
+
+		tags = append(tags, Tag{name, value})
+	}
+
+	for _, tag := range game.Tags {
+		if !isRosterTag(tag.Name) {
+			others = append(others, tag)
+		}
+	}
+
+	sort.SliceStable(others, func(i, j int) bool {
+		return others[i].Name < others[j].Name
+	})
+
+	return append(tags, others...)
+}
+
+func isRosterTag(name string) bool {
+	for _, rosterName := range SevenTagRoster {
+		if name == rosterName {
+			return true
+		}
+	}
+
+	return false
+}
+
+type movetextWriter struct {
+	out *bufio.Writer
+	pos *engine.BoardStruct
+
+	lineLength int
+
+	// Written in front of the next word, to open a variation.
+	prefix string
+}
+
+// Write the moves following the node, the main line with the variations
+// of each move right after it. The move number is written before a move
+// of white, and before a move of black that follows a comment or a
+// variation.
+func (w *movetextWriter) line(node *Node, number bool) {
+	plies := 0
+
+	for len(node.Children) > 0 {
+		main := node.Children[0]
+
+		w.move(main, number)
+
+		for _, variation := range node.Children[1:] {
+			w.prefix = "("
+			w.comment(variation.StartingComment)
+			w.move(variation, true)
+
+			w.pos.DoMove(variation.Move)
+			w.line(variation, variation.Comment != "")
+			w.pos.UndoMove()
+
+			w.closeVariation()
+		}
+
+		number = main.Comment != "" || len(node.Children) > 1
+
+		w.pos.DoMove(main.Move)
+		plies++
+		node = main
+	}
+
+	for ; plies > 0; plies-- {
+		w.pos.UndoMove()
+	}
+}
+
+// Write the move of the node with its number, NAGs and comment.
+func (w *movetextWriter) move(node *Node, number bool) {
+	ply := w.pos.StartPly + w.pos.HistoryPly
+	san := engine.MoveToSAN(w.pos, node.Move)
+
+	// The number is kept on the line of its move.
+	if w.pos.SideToMove == engine.White {
+		san = fmt.Sprintf("%d. %s", ply/2+1, san)
+	} else if number {
+		san = fmt.Sprintf("%d... %s", ply/2+1, san)
+	}
+
+	w.word(san)
+
+	for _, nag := range node.NAGs {
+		w.word(fmt.Sprintf("$%d", nag))
+	}
+
+	w.comment(node.Comment)
+}
+
+// Write a comment, word by word so it can be wrapped.
+func (w *movetextWriter) comment(comment string) {
+	// A comment ends at the first closing brace.
+	words := strings.Fields(strings.ReplaceAll(comment, "}", ")"))
+	if len(words) == 0 {
+		return
+	}
+
+	words[0] = "{" + words[0]
+	words[len(words)-1] += "}"
+
+	for _, word := range words {
+		w.word(word)
+	}
+}
+
+// Write a word of the movetext, separated by a space or a line break
+// from the previous one.
+func (w *movetextWriter) word(word string) {
+	word = w.prefix + word
+	w.prefix = ""
+
+	switch {
+	case w.lineLength == 0:
+	case w.lineLength+1+len(word) > maxLineLength:
+		w.out.WriteString("\n")
+		w.lineLength = 0
+	default:
+		w.out.WriteString(" ")
+		w.lineLength++
+	}
+
+	w.out.WriteString(word)
+	w.lineLength += len(word)
+}
+
+// End a variation, right after its last word.
+func (w *movetextWriter) closeVariation() {
+	if w.lineLength+1 > maxLineLength {
+		w.out.WriteString("\n")
+		w.lineLength = 0
+	}
+
+	w.out.WriteString(")")
+	w.lineLength++
+}
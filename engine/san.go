@@ -0,0 +1,223 @@
+package engine
+
+import "strings"
+
+// The letters of the piece types in SAN, indexed by piece type.
+const sanPieceChars = " PNBRQK"
+
+// MoveToSAN writes the legal move of the position in Standard Algebraic
+// Notation.
+func MoveToSAN(pos *BoardStruct, move Move) string {
+	from := move.FromSq()
+	to := move.ToSq()
+
+	var san strings.Builder
+
+	if move.MoveType() == Castle {
+		if FileOf(to) == FG {
+			san.WriteString("O-O")
+		} else {
+			san.WriteString("O-O-O")
+		}
+	} else {
+		piece := pos.Squares[from]
+		pieceType := sanPieceType(piece)
+		capture := pos.Squares[to] != Empty || move.MoveType() == Attack
+
+		if pieceType == Pawn {
+			if capture {
+				san.WriteByte(FileChar[FileOf(from)])
+			}
+		} else {
+			san.WriteByte(sanPieceChars[pieceType])
+			san.WriteString(sanDisambiguation(pos, move, piece))
+		}
+
+		if capture {
+			san.WriteByte('x')
+		}
+
+		san.WriteString(PrSq(to))
+
+		if move.MoveType() == Promotion {
+			san.WriteByte('=')
+			san.WriteByte(sanPieceChars[promotionPieceType(move)])
+		}
+	}
+
+	pos.DoMove(move)
+
+	if pos.InCheck() {
+		if legalMoveCount(pos) == 0 {
+			san.WriteByte('#')
+		} else {
+			san.WriteByte('+')
+		}
+	}
+
+	pos.UndoMove()
+
+	return san.String()
+}
+
+// Get the part of the from square needed to tell the move apart from the
+// moves of other pieces of the same kind to the same square. The file is
+// preferred, then the rank, and only if neither is enough both.
+func sanDisambiguation(pos *BoardStruct, move Move, piece uint8) string {
+	from := move.FromSq()
+
+	var list MoveList
+	GenerateLegalMoveList(pos, &list)
+
+	ambiguous, sameFile, sameRank := false, false, false
+
+	for moveNum := 0; moveNum < list.Count; moveNum++ {
+		other := list.Moves[moveNum].FromSq()
+
+		if list.Moves[moveNum].ToSq() != move.ToSq() || other == from || pos.Squares[other] != piece {
+			continue
+		}
+
+		ambiguous = true
+		sameFile = sameFile || FileOf(other) == FileOf(from)
+		sameRank = sameRank || RankOf(other) == RankOf(from)
+	}
+
+	switch {
+	case !ambiguous:
+		return ""
+	case !sameFile:
+		return FileChar[FileOf(from) : FileOf(from)+1]
+	case !sameRank:
+		return RankChar[RankOf(from) : RankOf(from)+1]
+	}
+
+	return PrSq(from)
+}
+
+// ParseSAN finds the legal move of the position written in Standard
+// Algebraic Notation. Besides strict SAN it accepts castling with zeros,
+// missing or superfluous capture signs, hyphens between the squares, a
+// fully given from square, promotions without '=' or with a lowercase
+// piece, a 'P' for pawns and trailing annotations such as "+", "!?" or
+// "e.p.". A missing promotion piece stands for a queen. NoMove is
+// returned if no move or more than one move fits.
+func ParseSAN(pos *BoardStruct, san string) Move {
+	san = strings.TrimSpace(san)
+	san = strings.TrimSuffix(san, "e.p.")
+	san = strings.TrimRight(san, "+#!? ")
+
+	var list MoveList
+	GenerateLegalMoveList(pos, &list)
+
+	switch strings.ReplaceAll(san, "0", "O") {
+	case "O-O":
+		return findCastle(&list, FG)
+	case "O-O-O":
+		return findCastle(&list, FC)
+	}
+
+	pieceType := Pawn
+	if san != "" && strings.IndexByte("PNBRQK", san[0]) >= 0 {
+		pieceType = uint8(strings.IndexByte(sanPieceChars, san[0]))
+		san = san[1:]
+	}
+
+	promoted := uint8(0)
+	if pieceType == Pawn && san != "" {
+		if index := strings.IndexByte("nbrq", toLowerByte(san[len(san)-1])); index >= 0 {
+			promoted = Knight + uint8(index)
+			san = strings.TrimSuffix(san[:len(san)-1], "=")
+		}
+	}
+
+	san = strings.NewReplacer("x", "", "X", "", ":", "", "-", "").Replace(san)
+	if len(san) < 2 || len(san) > 4 {
+		return NoMove
+	}
+
+	to, ok := parseSquare(san[len(san)-2:])
+	if !ok {
+		return NoMove
+	}
+
+	// What is left of the from square.
+	fromFile, fromRank := -1, -1
+	for i := 0; i < len(san)-2; i++ {
+		switch char := san[i]; {
+		case char >= 'a' && char <= 'h':
+			fromFile = int(char - 'a')
+		case char >= '1' && char <= '8':
+			fromRank = int(char - '1')
+		default:
+			return NoMove
+		}
+	}
+
+	found := NoMove
+
+	for moveNum := 0; moveNum < list.Count; moveNum++ {
+		move := list.Moves[moveNum]
+		from := move.FromSq()
+
+		if move.ToSq() != to || move.MoveType() == Castle || sanPieceType(pos.Squares[from]) != pieceType {
+			continue
+		}
+
+		if fromFile != -1 && FileOf(from) != fromFile || fromRank != -1 && RankOf(from) != fromRank {
+			continue
+		}
+
+		if move.MoveType() == Promotion {
+			if promoted == 0 && move.Flag() != QueenPromotion || promoted != 0 && promotionPieceType(move) != promoted {
+				continue
+			}
+		} else if promoted != 0 {
+			continue
+		}
+
+		if found != NoMove {
+			return NoMove
+		}
+
+		found = move
+	}
+
+	return found
+}
+
+func findCastle(list *MoveList, file int) Move {
+	for moveNum := 0; moveNum < list.Count; moveNum++ {
+		move := list.Moves[moveNum]
+
+		if move.MoveType() == Castle && FileOf(move.ToSq()) == file {
+			return move
+		}
+	}
+
+	return NoMove
+}
+
+func parseSquare(str string) (int, bool) {
+	if str[0] < 'a' || str[0] > 'h' || str[1] < '1' || str[1] > '8' {
+		return NoSq, false
+	}
+
+	return FR2SQ(int(str[0]-'a'), int(str[1]-'1')), true
+}
+
+func sanPieceType(piece uint8) uint8 {
+	return (piece-1)%6 + 1
+}
+
+func promotionPieceType(move Move) uint8 {
+	return Knight + move.Flag()
+}
+
+func toLowerByte(char byte) byte {
+	if char >= 'A' && char <= 'Z' {
+		return char + 'a' - 'A'
+	}
+
+	return char
+}
@@ -0,0 +1,123 @@
+package engine
+
+import "testing"
+
+// Every legal move of the positions has to survive SAN -> move -> SAN,
+// and no two moves may share a SAN.
+func TestSANRoundTrip(t *testing.T) {
+	fens := []string{
+		FENStart,
+		// Castling both ways, en passant, and knights and rooks that need
+		// disambiguation.
+		"r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1",
+		"rnbqkbnr/ppp1p1pp/8/3pPp2/8/8/PPPP1PPP/RNBQKBNR w KQkq f6 0 3",
+		// Promotions with and without captures.
+		"n1n5/PPPk4/8/8/8/8/4Kppp/5N1N b - - 0 1",
+		"n1n5/PPPk4/8/8/8/8/4Kppp/5N1N w - - 0 1",
+		// Three queens that can reach the same squares.
+		"8/7k/8/8/Q7/8/8/Q2Q2K1 w - - 0 1",
+		"rnbq1k1r/pp1Pbppp/2p5/8/2B5/8/PPP1NnPP/RNBQK2R w KQ - 1 8",
+	}
+
+	for _, fen := range fens {
+		pos := mustParseFen(t, fen)
+
+		var list MoveList
+		GenerateLegalMoveList(pos, &list)
+
+		seen := make(map[string]bool)
+
+		for moveNum := 0; moveNum < list.Count; moveNum++ {
+			move := list.Moves[moveNum]
+			san := MoveToSAN(pos, move)
+
+			if seen[san] {
+				t.Errorf("%s: two moves written as %s", fen, san)
+			}
+			seen[san] = true
+
+			parsed := ParseSAN(pos, san)
+			if !parsed.Equal(move) {
+				t.Errorf("%s: ParseSAN(%s) = %s, want %s", fen, san, parsed, move)
+				continue
+			}
+
+			if again := MoveToSAN(pos, parsed); again != san {
+				t.Errorf("%s: %s became %s", fen, san, again)
+			}
+		}
+	}
+}
+
+func TestMoveToSAN(t *testing.T) {
+	tests := []struct {
+		fen  string
+		move string
+		san  string
+	}{
+		{FENStart, "g1f3", "Nf3"},
+		{FENStart, "e2e4", "e4"},
+		{"r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1", "e1g1", "O-O"},
+		{"r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1", "e1c1", "O-O-O"},
+		{"r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1", "g2h3", "gxh3"},
+		{"rnbqkbnr/ppp1p1pp/8/3pPp2/8/8/PPPP1PPP/RNBQKBNR w KQkq f6 0 3", "e5f6", "exf6"},
+		{"8/7k/8/8/Q7/8/8/Q2Q2K1 w - - 0 1", "a1d4", "Qa1d4"},
+		{"8/7k/8/8/Q7/8/8/Q2Q2K1 w - - 0 1", "a4d4", "Q4d4"},
+		{"8/7k/8/8/Q7/8/8/Q2Q2K1 w - - 0 1", "d1d4", "Qdd4"},
+		{"8/7k/8/8/Q7/8/8/Q2Q2K1 w - - 0 1", "d1h5", "Qh5+"},
+		{"4k3/8/8/8/8/8/4K3/R6R w - - 0 1", "a1d1", "Rad1"},
+		{"n1n5/PPPk4/8/8/8/8/4Kppp/5N1N w - - 0 1", "b7b8q", "b8=Q"},
+		{"n1n5/PPPk4/8/8/8/8/4Kppp/5N1N w - - 0 1", "b7c8q", "bxc8=Q+"},
+		{"n1n5/PPPk4/8/8/8/8/4Kppp/5N1N w - - 0 1", "b7a8n", "bxa8=N"},
+		{"6k1/5ppp/8/8/8/8/8/R5K1 w - - 0 1", "a1a8", "Ra8#"},
+	}
+
+	for _, test := range tests {
+		pos := mustParseFen(t, test.fen)
+
+		move := ParseMove(test.move, pos)
+		if move == NoMove {
+			t.Fatalf("%s: %s isn't legal", test.fen, test.move)
+		}
+
+		if san := MoveToSAN(pos, move); san != test.san {
+			t.Errorf("%s: MoveToSAN(%s) = %s, want %s", test.fen, test.move, san, test.san)
+		}
+	}
+}
+
+func TestParseSANVariants(t *testing.T) {
+	tests := []struct {
+		fen  string
+		san  string
+		move string
+	}{
+		{"r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1", "0-0", "e1g1"},
+		{"r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1", "O-O-O+", "e1c1"},
+		{"r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1", "Nd7", "e5d7"},
+		{"r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1", "Ne5xd7!?", "e5d7"},
+		{"r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1", "Qf3-f6", "f3f6"},
+		{"r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1", "Pa3", "a2a3"},
+		{"rnbqkbnr/ppp1p1pp/8/3pPp2/8/8/PPPP1PPP/RNBQKBNR w KQkq f6 0 3", "exf6 e.p.", "e5f6"},
+		{"n1n5/PPPk4/8/8/8/8/4Kppp/5N1N w - - 0 1", "b8Q", "b7b8q"},
+		{"n1n5/PPPk4/8/8/8/8/4Kppp/5N1N w - - 0 1", "b8=q", "b7b8q"},
+		{"n1n5/PPPk4/8/8/8/8/4Kppp/5N1N w - - 0 1", "b8", "b7b8q"},
+		{"n1n5/PPPk4/8/8/8/8/4Kppp/5N1N w - - 0 1", "bxc8=R", "b7c8r"},
+	}
+
+	for _, test := range tests {
+		pos := mustParseFen(t, test.fen)
+
+		if move := ParseSAN(pos, test.san); move.String() != test.move {
+			t.Errorf("%s: ParseSAN(%s) = %s, want %s", test.fen, test.san, move, test.move)
+		}
+	}
+
+	// Ambiguous, illegal and malformed moves aren't accepted.
+	pos := mustParseFen(t, "8/7k/8/8/Q7/8/8/Q2Q2K1 w - - 0 1")
+	for _, san := range []string{"Qd4", "Qb8", "Kh8", "Zz9", "", "O-O"} {
+		if move := ParseSAN(pos, san); move != NoMove {
+			t.Errorf("ParseSAN(%q) = %s, want no move", san, move)
+		}
+	}
+}
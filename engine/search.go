@@ -2,6 +2,10 @@ package engine
 
 import (
 	"fmt"
+	"math"
+	"sort"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -9,49 +13,135 @@ const (
 	MaxDepth = 64
 	INFINITE = 30000
 
-	// A constant representing the score of the principal variation
-	// move from the transposition table.
-	PVMoveScore uint16 = 10_000
+	// The score of being checkmated at the root. A mate found n plies into
+	// the search scores MateScore - n for the mating side.
+	MateScore = 29000
 
-	// A constant representing the score offsets of the killer moves.
-	FirstKillerMoveScore  uint16 = 1000
-	SecondKillerMoveScore uint16 = 2000
+	// Scores beyond this bound are mate scores.
+	ISMATE = MateScore - MaxDepth
 
-	// A constant to offset the score of the pv and MVV-LVA move higher
-	// than killers and history heuristic moves.
+	// The milliseconds after which the root moves being searched are
+	// reported with currmove.
+	CurrMoveDelay = 3000
+
+	// The minimum depth for null move pruning, and the base reduction of
+	// the null move search.
+	NullMoveMinDepth  = 3
+	NullMoveReduction = 2
+
+	// Late move reductions apply from this depth on, and only to moves
+	// after the first few.
+	LMRMinDepth = 3
+	LMRMinMoves = 3
+
+	// Aspiration windows are used from this depth on. They start this many
+	// centipawns wide on each side, and fall back to a full window once
+	// they have grown past the maximum.
+	AspirationMinDepth  = 4
+	AspirationWindow    = 25
+	AspirationMaxWindow = 500
+
+	// A constant to offset the score of captures, which keeps captures
+	// of pawns by kings above zero.
 	MvvLvaOffset uint16 = 10_000
 )
 
 type Search struct {
-	Starttime int64
-	Stoptime  int64
-	Depth     int
-	Timeset   bool
+	Time  TimeManager
+	Depth int
+
+	// Stopped is raised by the UCI loop on "stop" or "quit" and by checkUp
+	// once the time is up. The search goroutines poll it, so it must only
+	// be accessed atomically.
+	Stopped atomic.Bool
+
+	TT TranspositionTable
+
+	// The number of threads searching the position (lazy SMP). Helper
+	// threads run their own iterative deepening on a copy of the position
+	// and only communicate with the main thread through the shared
+	// transposition table.
+	Threads int
+
+	// The number of best root moves to report, set by the "MultiPV" option.
+	MultiPV int
+
+	// When set by "go mate", the search ends as soon as it finds a mate
+	// in at most this many moves.
+	Mate int
+
+	// Set by "go infinite". The best move is then held back until the
+	// search is stopped, even if it ends earlier on its own.
+	Infinite bool
+
+	// The evaluation of the positions, switched by the "UseNNUE" option.
+	Evaluator Evaluator
+
+	threads []*SearchThread
+}
 
-	Nodes int64
+// SearchThread holds the state owned by a single thread of the search.
+type SearchThread struct {
+	*Search
 
-	Stopped bool
+	ID  int
+	Pos BoardStruct
+
+	// Nodes is read by the main thread to report the total node count.
+	Nodes atomic.Int64
+
+	// The highest ply reached in the current iteration, quiescence
+	// search included.
+	SelDepth int
 
-	TT      TranspositionTable
 	PvArray [MaxDepth]Move
 
+	// The best move found by the last root search, and the root moves it
+	// has to skip because earlier MultiPV lines already reported them.
+	rootBest     Move
+	rootExcluded []Move
+
+	Heuristics
+
+	PawnTable PawnTable
+
 	Fh  float32
 	Fhf float32
+
+	// Statistics of the selective search, reported at the end.
+	NullCutoffs int64
+	Reductions  int64
+	ReSearches  int64
 }
 
-func (search *Search) GetPvLine(depth int, pos *BoardStruct) int {
-	move := search.TT.Probe(pos.Hash).Best
+// The depth reduction of a late move, indexed by depth and move number.
+var LMRTable [MaxDepth][maxPositionMoves]int
+
+func InitReductions() {
+	for depth := 1; depth < MaxDepth; depth++ {
+		for moveNum := 1; moveNum < maxPositionMoves; moveNum++ {
+			LMRTable[depth][moveNum] = int(0.75 + math.Log(float64(depth))*math.Log(float64(moveNum))/2.25)
+		}
+	}
+}
+
+// GetPvLine collects the pv of the last root search. The first move is
+// the one the thread found itself, as the root entry in the table may have
+// been overwritten by another thread or another MultiPV line.
+func (thread *SearchThread) GetPvLine(depth int, pos *BoardStruct) int {
+	move := thread.rootBest
 	count := 0
 
 	for move != NoMove && count < depth {
 		if pos.MoveExists(move) {
 			pos.DoMove(move)
-			search.PvArray[count] = move
+			thread.PvArray[count] = move
 			count++
 		} else {
 			break
 		}
-		move = search.TT.Probe(pos.Hash).Best
+		entry, _ := thread.TT.Probe(pos.Hash)
+		move = entry.Best
 	}
 
 	for pos.Ply > 0 {
@@ -61,22 +151,32 @@ func (search *Search) GetPvLine(depth int, pos *BoardStruct) int {
 	return count
 }
 
-func (search *Search) Quiescence(alpha int, beta int, pos *BoardStruct) int {
-	if (search.Nodes & 2047) == 0 {
-		search.checkUp()
+func (thread *SearchThread) Quiescence(alpha int, beta int, pos *BoardStruct) int {
+	if (thread.Nodes.Add(1) & 2047) == 0 {
+		thread.checkUp()
 	}
 
-	search.Nodes++
+	if pos.Ply > thread.SelDepth {
+		thread.SelDepth = pos.Ply
+	}
 
 	if isRepetition(pos) || pos.Rule50 >= 100 {
 		return 0
 	}
 
 	if pos.Ply > MaxDepth-1 {
-		return EvalPosition(pos)
+		return thread.Evaluator.Evaluate(pos)
+	}
+
+	entry, ttHit := thread.TT.Probe(pos.Hash)
+
+	if ttHit {
+		if score, ok := ttCutoff(entry, alpha, beta, 0, pos.Ply); ok {
+			return score
+		}
 	}
 
-	score := EvalPosition(pos)
+	score := thread.Evaluator.Evaluate(pos)
 
 	if score >= beta {
 		return beta
@@ -86,68 +186,74 @@ func (search *Search) Quiescence(alpha int, beta int, pos *BoardStruct) int {
 		alpha = score
 	}
 
-	var list MoveList
-	GenerateAllMoves(pos, &list, false)
+	// The picker only returns captures not losing material, the others
+	// are very unlikely to raise alpha and aren't worth searching.
+	var picker MovePicker
+	picker.Init(pos, &thread.Heuristics, entry.Best, false)
 
 	legal := 0
 	oldAlpha := alpha
 	bestMove := NoMove
 	score = -INFINITE
 
-	for moveNum := 0; moveNum < list.Count; moveNum++ {
-
-		list.PickNextMove(moveNum)
-
-		if !pos.DoMove(list.Moves[moveNum]) {
-			continue
-		}
+	for move := picker.Next(); move != NoMove; move = picker.Next() {
+		pos.makeMove(move)
 
 		legal++
-		score = -search.Quiescence(-beta, -alpha, pos)
+		score = -thread.Quiescence(-beta, -alpha, pos)
 		pos.UndoMove()
 
-		if search.Stopped {
+		if thread.Stopped.Load() {
 			return 0
 		}
 
 		if score > alpha {
 			if score >= beta {
 				if legal == 1 {
-					search.Fhf++
+					thread.Fhf++
 				}
-				search.Fh++
+				thread.Fh++
 
+				thread.TT.Store(pos.Hash, move, beta, 0, BetaFlag, pos.Ply)
 				return beta
 			}
 			alpha = score
-			bestMove = list.Moves[moveNum]
+			bestMove = move
 		}
 	}
 
 	if alpha != oldAlpha {
-		search.TT.Store(pos.Hash, bestMove)
+		thread.TT.Store(pos.Hash, bestMove, alpha, 0, ExactFlag, pos.Ply)
+	} else {
+		thread.TT.Store(pos.Hash, NoMove, alpha, 0, AlphaFlag, pos.Ply)
 	}
 
 	return alpha
 }
 
-func (search *Search) AlphaBeta(alpha int, beta int, depth int, pos *BoardStruct) int {
-	if depth == 0 {
-		return search.Quiescence(alpha, beta, pos)
+func (thread *SearchThread) AlphaBeta(alpha int, beta int, depth int, pos *BoardStruct, doNull bool) int {
+	if depth <= 0 {
+		return thread.Quiescence(alpha, beta, pos)
 	}
 
-	if (search.Nodes & 2047) == 0 {
-		search.checkUp()
+	if (thread.Nodes.Add(1) & 2047) == 0 {
+		thread.checkUp()
 	}
 
-	search.Nodes++
-
 	if (isRepetition(pos) || pos.Rule50 >= 100) && pos.Ply != 0 {
 		return 0
 	}
 
 	if pos.Ply > MaxDepth-1 {
-		return EvalPosition(pos)
+		return thread.Evaluator.Evaluate(pos)
+	}
+
+	// Right after a capture or a pawn move the position may have entered
+	// the tablebases, which know its exact result.
+	if pos.Ply != 0 && pos.Rule50 == 0 && len(tablebases) > 0 {
+		if result, dtm, ok := ProbeTablebase(pos); ok {
+			return tbScore(result, dtm, pos.Ply)
+		}
 	}
 
 	kingBB := pos.Pieces[AllPieces[pos.SideToMove][King]]
@@ -157,137 +263,545 @@ func (search *Search) AlphaBeta(alpha int, beta int, depth int, pos *BoardStruct
 		depth++
 	}
 
-	var list MoveList
-	GenerateAllMoves(pos, &list, true)
+	pvNode := beta-alpha > 1
 
-	legal := 0
-	oldAlpha := alpha
-	bestMove := NoMove
-	score := -INFINITE
-	pvMove := search.TT.Probe(pos.Hash).Best
+	pvMove := NoMove
+	entry, ttHit := thread.TT.Probe(pos.Hash)
 
-	if pvMove != NoMove {
-		for moveNum := 0; moveNum < list.Count; moveNum++ {
-			if list.Moves[moveNum].Equal(pvMove) {
-				list.Moves[moveNum].AddScore(MvvLvaOffset + PVMoveScore)
-				break
+	if ttHit {
+		pvMove = entry.Best
+
+		// PV nodes are searched even with a usable entry, a cutoff there
+		// would cut short the line reported to the GUI.
+		if pos.Ply != 0 && !pvNode {
+			if score, ok := ttCutoff(entry, alpha, beta, depth, pos.Ply); ok {
+				return score
 			}
+		}
+	}
+
+	// Null move pruning: give the opponent a free move, and if a reduced
+	// search still fails high the position is good enough to cut. Skipped
+	// without any pieces besides pawns, where zugzwang makes passing an
+	// unfair advantage.
+	if doNull && !inCheck && !pvNode && pos.Ply != 0 && depth >= NullMoveMinDepth && hasNonPawnMaterial(pos) {
+		reduction := NullMoveReduction + depth/6
+
+		thread.Push(pos.Ply, NoMove, Empty)
+		pos.DoNullMove()
+		score := -thread.AlphaBeta(-beta, -beta+1, depth-1-reduction, pos, false)
+		pos.UndoNullMove()
+
+		if thread.Stopped.Load() {
+			return 0
+		}
 
+		if score >= beta && score < ISMATE {
+			thread.NullCutoffs++
+			return beta
 		}
 	}
 
-	for moveNum := 0; moveNum < list.Count; moveNum++ {
-		list.PickNextMove(moveNum)
+	var picker MovePicker
+	picker.Init(pos, &thread.Heuristics, pvMove, true)
 
-		if !pos.DoMove(list.Moves[moveNum]) {
+	legal := 0
+	oldAlpha := alpha
+	bestMove := NoMove
+	score := -INFINITE
+
+	// A root search that skips the moves of earlier MultiPV lines only
+	// knows part of the position, so it must not overwrite its entry.
+	storeTT := pos.Ply != 0 || len(thread.rootExcluded) == 0
+
+	// The quiet moves searched so far, whose history is lowered when a
+	// later quiet move causes a cutoff.
+	var quietsTried [maxPositionMoves]Move
+	quietCount := 0
+
+	for move := picker.Next(); move != NoMove; move = picker.Next() {
+		if pos.Ply == 0 && thread.isExcluded(move) {
 			continue
 		}
 
+		quiet := !pos.IsCapture(move) && move.MoveType() != Promotion
+		killer := thread.IsKiller(pos.Ply, move)
+
+		thread.Push(pos.Ply, move, pos.Squares[move.FromSq()])
+
+		pos.makeMove(move)
+
 		legal++
-		score = -search.AlphaBeta(-beta, -alpha, depth-1, pos)
+
+		if pos.Ply == 1 && thread.ID == 0 {
+			thread.printCurrMove(depth, move, legal)
+		}
+
+		if legal == 1 {
+			score = -thread.AlphaBeta(-beta, -alpha, depth-1, pos, true)
+		} else {
+			// Late move reductions: quiet moves ordered late are unlikely
+			// to be best, so they are searched shallower first.
+			reduction := 0
+
+			if quiet && !killer && !inCheck && depth >= LMRMinDepth && legal > LMRMinMoves && !pos.InCheck() {
+				reduction = LMRTable[min(depth, MaxDepth-1)][min(legal, maxPositionMoves-1)]
+
+				if pvNode {
+					reduction--
+				}
+				reduction = min(max(reduction, 0), depth-2)
+			}
+
+			if reduction > 0 {
+				thread.Reductions++
+			}
+
+			// Principal variation search: the first move is expected to be
+			// best, so the others are only tried with a null window, and
+			// are searched again when they beat alpha after all.
+			score = -thread.AlphaBeta(-alpha-1, -alpha, depth-1-reduction, pos, true)
+
+			if score > alpha && reduction > 0 {
+				thread.ReSearches++
+				score = -thread.AlphaBeta(-alpha-1, -alpha, depth-1, pos, true)
+			}
+
+			if score > alpha && score < beta {
+				thread.ReSearches++
+				score = -thread.AlphaBeta(-beta, -alpha, depth-1, pos, true)
+			}
+		}
+
 		pos.UndoMove()
 
-		if search.Stopped {
+		if thread.Stopped.Load() {
 			return 0
 		}
 
 		if score > alpha {
 			if score >= beta {
 				if legal == 1 {
-					search.Fhf++
+					thread.Fhf++
+				}
+				thread.Fh++
+
+				if quiet {
+					thread.UpdateQuiet(pos, move, quietsTried[:quietCount], depth)
 				}
-				search.Fh++
 
-				if list.Moves[moveNum].MoveType() == Attack {
-					pos.SearchKillers[1][pos.Ply] = pos.SearchKillers[0][pos.Ply]
-					pos.SearchKillers[0][pos.Ply] = list.Moves[moveNum]
+				if pos.Ply == 0 {
+					thread.rootBest = move
 				}
 
+				if storeTT {
+					thread.TT.Store(pos.Hash, move, beta, depth, BetaFlag, pos.Ply)
+				}
 				return beta
 			}
 			alpha = score
-			bestMove = list.Moves[moveNum]
+			bestMove = move
 
-			if list.Moves[moveNum].MoveType() == Attack {
-				pos.SearchHistory[pos.Squares[bestMove.FromSq()]][bestMove.ToSq()] += uint16(depth)
+			if pos.Ply == 0 {
+				thread.rootBest = bestMove
 			}
 		}
+
+		if quiet {
+			quietsTried[quietCount] = move
+			quietCount++
+		}
 	}
 
 	if legal == 0 {
 		if inCheck {
-			return -INFINITE + pos.Ply
+			return -MateScore + pos.Ply
 		} else {
 			return 0
 		}
 	}
 
+	if !storeTT {
+		return alpha
+	}
+
 	if alpha != oldAlpha {
-		search.TT.Store(pos.Hash, bestMove)
+		thread.TT.Store(pos.Hash, bestMove, alpha, depth, ExactFlag, pos.Ply)
+	} else {
+		thread.TT.Store(pos.Hash, NoMove, alpha, depth, AlphaFlag, pos.Ply)
 	}
 
 	return alpha
 }
 
+// ttCutoff reports whether a table entry searched at least to the given
+// depth has a score that settles the node for the current window.
+func ttCutoff(entry SearchEntry, alpha int, beta int, depth int, ply int) (int, bool) {
+	if int(entry.Depth) < depth {
+		return 0, false
+	}
+
+	score := entry.ScoreAt(ply)
+
+	switch entry.Flag {
+	case ExactFlag:
+		return score, true
+	case AlphaFlag:
+		if score <= alpha {
+			return alpha, true
+		}
+	case BetaFlag:
+		if score >= beta {
+			return beta, true
+		}
+	}
+
+	return 0, false
+}
+
 func (search *Search) SearchPosition(pos *BoardStruct) {
+	// Without a legal move there is nothing to search, just report
+	// whether the side to move is mated or stalemated.
+	if legalMoveCount(pos) == 0 {
+		kingBB := pos.Pieces[AllPieces[pos.SideToMove][King]]
+
+		if SqAttacked(kingBB.Msb(), pos, pos.SideToMove^1) {
+			fmt.Println("info depth 0 score mate 0")
+		} else {
+			fmt.Println("info depth 0 score cp 0")
+		}
+		search.waitForStop()
+		fmt.Printf("bestmove %s\n", NoMove.String())
+		return
+	}
+
+	search.clearForSearch(pos)
+
+	// In the tablebases the score of every move is known without
+	// searching, so the lines are reported right away.
+	if lines := tablebaseLines(&search.threads[0].Pos); lines != nil {
+		for i, line := range lines[:min(max(search.MultiPV, 1), len(lines))] {
+			search.threads[0].printInfo(1, i+1, line.score, "", line.pv)
+		}
+
+		search.waitForStop()
+		fmt.Printf("bestmove %s\n", lines[0].pv[0].String())
+		return
+	}
+
+	var helpers sync.WaitGroup
+
+	for _, thread := range search.threads[1:] {
+		helpers.Add(1)
+
+		go func(thread *SearchThread) {
+			defer helpers.Done()
+			thread.iterativeDeepening()
+		}(thread)
+	}
+
+	// The main thread alone decides on the move. Once it is done, the
+	// helpers are stopped as well.
+	bestMove := search.threads[0].iterativeDeepening()
+
+	search.waitForStop()
+	search.Stopped.Store(true)
+	helpers.Wait()
+
+	main := search.threads[0]
+	if main.Fh > 0 {
+		fmt.Printf("info string ordering %.2f\n", main.Fhf/main.Fh)
+	}
+	fmt.Printf("info string nullcutoffs %d reductions %d researches %d\n",
+		main.NullCutoffs, main.Reductions, main.ReSearches)
+
+	fmt.Printf("bestmove %s\n", bestMove.String())
+}
+
+// waitForStop holds back the best move of a "go infinite" search until
+// "stop" is sent, as the UCI protocol requires. The search can end before
+// that on its own, at the depth limit or when the root has nothing to
+// search.
+func (search *Search) waitForStop() {
+	for search.Infinite && !search.Stopped.Load() {
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func (thread *SearchThread) iterativeDeepening() Move {
+	pos := &thread.Pos
 	bestMove := NoMove
 	bestScore := -INFINITE
-	pvMoves := 0
 
-	search.clearForSearch(pos)
+	// Only the main thread reports several lines, the helpers just fill
+	// the table with the best line.
+	multiPV := 1
+	if thread.ID == 0 {
+		multiPV = min(max(thread.MultiPV, 1), legalMoveCount(pos))
+	}
 
-	for currentDepth := 1; currentDepth <= search.Depth; currentDepth++ {
-		bestScore = search.AlphaBeta(-INFINITE, INFINITE, currentDepth, pos)
+	// Let every other helper start one ply deeper, so the threads spread
+	// over different depths instead of all searching the same tree.
+	startDepth := 1 + thread.ID%2
 
-		if search.Stopped {
-			break
+	// The score of each line in the previous iteration, which the
+	// aspiration windows of the next one are centered on.
+	prevScores := make([]int, multiPV)
+
+	for currentDepth := startDepth; currentDepth <= thread.Depth; currentDepth++ {
+		thread.rootExcluded = thread.rootExcluded[:0]
+		thread.SelDepth = 0
+
+		// The lines are searched one after another, but a later line can
+		// still score higher than an earlier one, so they are sorted
+		// before they are reported.
+		var lines []rootLine
+
+		for pvNum := 1; pvNum <= multiPV; pvNum++ {
+			score, pvMoves := thread.searchRoot(currentDepth, pvNum, prevScores[pvNum-1])
+
+			if thread.Stopped.Load() {
+				break
+			}
+
+			if pvMoves == 0 {
+				break
+			}
+
+			lines = append(lines, rootLine{score, append([]Move{}, thread.PvArray[:pvMoves]...)})
+			thread.rootExcluded = append(thread.rootExcluded, thread.PvArray[0])
 		}
 
-		pvMoves = search.GetPvLine(currentDepth, pos)
-		bestMove = search.PvArray[0]
+		sort.SliceStable(lines, func(i, j int) bool {
+			return lines[i].score > lines[j].score
+		})
+
+		for i, line := range lines {
+			prevScores[i] = line.score
+
+			if thread.ID == 0 {
+				thread.printInfo(currentDepth, i+1, line.score, "", line.pv)
+			}
+		}
+
+		if len(lines) > 0 {
+			bestMove = lines[0].pv[0]
+			bestScore = lines[0].score
+
+			if thread.Mate > 0 && bestScore >= MateScore-(2*thread.Mate-1) {
+				return bestMove
+			}
+		}
+
+		if thread.Stopped.Load() {
+			break
+		}
 
-		fmt.Printf("\ninfo score cp %d depth %d nodes %d time %d pv",
-			bestScore, currentDepth, search.Nodes, time.Now().UnixMilli()-int64(search.Starttime))
+		if thread.ID == 0 {
+			thread.Time.UpdateIteration(bestMove, bestScore)
 
-		for pvNum := 0; pvNum < pvMoves; pvNum++ {
-			fmt.Printf(" %s", search.PvArray[pvNum].String())
+			if thread.Time.SoftLimitReached() {
+				break
+			}
 		}
-		fmt.Println()
-		//fmt.Printf(" Ordering: %f\n", info.Fhf/info.Fh)
 	}
 
-	fmt.Printf("bestmove %s\n", bestMove.String())
+	// A stop can arrive before the first iteration completes, in which
+	// case we still have to report some legal move.
+	if bestMove == NoMove {
+		bestMove = firstLegalMove(pos)
+	}
+
+	return bestMove
 }
 
-func (search *Search) clearForSearch(pos *BoardStruct) {
-	for index := 0; index < 13; index++ {
-		for index2 := 0; index2 < 64; index2++ {
-			pos.SearchHistory[index][index2] = 0
+// A line of the root position found by the search.
+type rootLine struct {
+	score int
+	pv    []Move
+}
+
+// searchRoot searches one MultiPV line of the root position. From
+// AspirationMinDepth on, the search starts with a narrow window around
+// the line's score of the previous iteration, which is widened step by
+// step on the side the score falls out of.
+func (thread *SearchThread) searchRoot(depth int, pvNum int, prevScore int) (int, int) {
+	pos := &thread.Pos
+	alpha, beta := -INFINITE, INFINITE
+	delta := AspirationWindow
+
+	if depth >= AspirationMinDepth && prevScore > -ISMATE && prevScore < ISMATE {
+		alpha = prevScore - delta
+		beta = prevScore + delta
+	}
+
+	for {
+		thread.rootBest = NoMove
+		score := thread.AlphaBeta(alpha, beta, depth, pos, true)
+
+		if thread.Stopped.Load() {
+			return score, 0
+		}
+
+		if score <= alpha && alpha > -INFINITE {
+			if thread.ID == 0 {
+				thread.printInfo(depth, pvNum, alpha, "upperbound", nil)
+			}
+			alpha = max(score-delta, -INFINITE)
+		} else if score >= beta && beta < INFINITE {
+			if thread.ID == 0 {
+				thread.printInfo(depth, pvNum, beta, "lowerbound", thread.PvArray[:thread.GetPvLine(depth, pos)])
+			}
+			beta = min(score+delta, INFINITE)
+		} else {
+			return score, thread.GetPvLine(depth, pos)
+		}
+
+		delta += delta / 2
+
+		if delta > AspirationMaxWindow {
+			alpha, beta = -INFINITE, INFINITE
 		}
 	}
+}
+
+// printInfo reports a searched line. The bound is empty for an exact
+// score, otherwise "lowerbound" or "upperbound" as the UCI protocol
+// names them.
+func (thread *SearchThread) printInfo(depth int, pvNum int, score int, bound string, pv []Move) {
+	elapsed := thread.Time.Elapsed()
+	nodes := thread.nodes()
+
+	scoreStr := scoreToUci(score)
+	if bound != "" {
+		scoreStr += " " + bound
+	}
+
+	fmt.Printf("info depth %d seldepth %d multipv %d score %s nodes %d nps %d hashfull %d time %d",
+		depth, max(thread.SelDepth, depth), pvNum, scoreStr, nodes, nodes*1000/max(elapsed, 1),
+		thread.TT.Hashfull(), elapsed)
+
+	if len(pv) > 0 {
+		fmt.Print(" pv")
+	}
+
+	for _, move := range pv {
+		fmt.Printf(" %s", move.String())
+	}
+	fmt.Println()
+}
 
-	for index := 0; index < 2; index++ {
-		for index2 := 0; index2 < MaxDepth; index2++ {
-			pos.SearchKillers[index][index2] = 0
+// printCurrMove reports the root move being searched. Only done once the
+// search has run for a while, so fast searches aren't flooded with output.
+func (thread *SearchThread) printCurrMove(depth int, move Move, moveNum int) {
+	if thread.Time.Elapsed() < CurrMoveDelay {
+		return
+	}
+
+	fmt.Printf("info depth %d currmove %s currmovenumber %d\n", depth, move.String(), moveNum)
+}
+
+// scoreToUci formats a score as "cp <centipawns>", or as "mate <moves>"
+// for mate scores, negative when the side to move is getting mated.
+func scoreToUci(score int) string {
+	if score > ISMATE {
+		return fmt.Sprintf("mate %d", (MateScore-score+1)/2)
+	} else if score < -ISMATE {
+		return fmt.Sprintf("mate %d", -(MateScore+score)/2)
+	}
+
+	return fmt.Sprintf("cp %d", score)
+}
+
+func (thread *SearchThread) isExcluded(move Move) bool {
+	for _, excluded := range thread.rootExcluded {
+		if excluded.Equal(move) {
+			return true
 		}
 	}
 
-	pos.Ply = 0
+	return false
+}
+
+func (search *Search) clearForSearch(pos *BoardStruct) {
+	threads := search.Threads
+	if threads < 1 {
+		threads = 1
+	}
+
+	for len(search.threads) < threads {
+		search.threads = append(search.threads, &SearchThread{Search: search, ID: len(search.threads)})
+	}
+	search.threads = search.threads[:threads]
+
+	for _, thread := range search.threads {
+		thread.Pos = *pos
+		thread.Pos.Ply = 0
+		search.Evaluator.Init(&thread.Pos)
+
+		// The pawn table is cleared, since the evaluation weights may have
+		// changed since the last search.
+		thread.PawnTable.Clear()
+		thread.Pos.PawnTable = &thread.PawnTable
+
+		thread.Heuristics.Clear()
+
+		thread.Nodes.Store(0)
+		thread.Fh = 0
+		thread.Fhf = 0
+		thread.NullCutoffs = 0
+		thread.Reductions = 0
+		thread.ReSearches = 0
+	}
+
+	search.TT.NewSearch()
+}
+
+// Get the number of nodes searched by all threads together.
+func (search *Search) nodes() int64 {
+	var nodes int64
+
+	for _, thread := range search.threads {
+		nodes += thread.Nodes.Load()
+	}
 
-	search.Stopped = false
-	search.Nodes = 0
-	search.Fh = 0
-	search.Fhf = 0
+	return nodes
 }
 
 func (search *Search) checkUp() {
-	if search.Timeset && time.Now().UnixMilli() > int64(search.Stoptime) {
-		search.Stopped = true
+	if search.Time.HardLimitReached(search.nodes()) {
+		search.Stopped.Store(true)
 	}
 }
 
+func firstLegalMove(pos *BoardStruct) Move {
+	var list MoveList
+	GenerateLegalMoveList(pos, &list)
+
+	if list.Count == 0 {
+		return NoMove
+	}
+
+	return list.Moves[0]
+}
+
+// Check whether the side to move has any piece besides pawns and the king.
+func hasNonPawnMaterial(pos *BoardStruct) bool {
+	side := pos.SideToMove
+	pawns := pos.Pieces[AllPieces[side][Pawn]].CountBits()
+
+	return getMaterial(pos, side)-pawns*PieceVal[AllPieces[side][Pawn]]-PieceVal[AllPieces[side][King]] > 0
+}
+
+func legalMoveCount(pos *BoardStruct) int {
+	var list MoveList
+	GenerateLegalMoveList(pos, &list)
+
+	return list.Count
+}
+
 func isRepetition(pos *BoardStruct) bool {
-	for i := pos.HistoryPly - pos.Rule50; i < pos.HistoryPly-1; i++ {
+	for i := max(pos.HistoryPly-pos.Rule50, 0); i < pos.HistoryPly-1; i++ {
 		if pos.Hash == pos.History[i].Hash {
 			return true
 		}
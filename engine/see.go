@@ -0,0 +1,96 @@
+package engine
+
+// The piece values used by the static exchange evaluation. The king is
+// worth more than everything else together, so it is always the last
+// piece to recapture.
+var SeePieceVal = [13]int{0, 100, 320, 330, 500, 900, 10_000, 100, 320, 330, 500, 900, 10_000}
+
+// Get the pieces of both sides attacking the square, given the occupancy.
+// Sliders are found through the occupancy, so passing an occupancy with
+// pieces removed reveals the x-ray attackers behind them.
+func attackersTo(pos *BoardStruct, sq int, occupied Bitboard) Bitboard {
+	bishopsQueens := pos.Pieces[wBishop] | pos.Pieces[bBishop] | pos.Pieces[wQueen] | pos.Pieces[bQueen]
+	rooksQueens := pos.Pieces[wRook] | pos.Pieces[bRook] | pos.Pieces[wQueen] | pos.Pieces[bQueen]
+
+	return (PawnAttacks[White][sq] & pos.Pieces[wPawn]) |
+		(PawnAttacks[Black][sq] & pos.Pieces[bPawn]) |
+		(KnightAttacks[sq] & (pos.Pieces[wKnight] | pos.Pieces[bKnight])) |
+		(KingAttacks[sq] & (pos.Pieces[wKing] | pos.Pieces[bKing])) |
+		(genBishopMoves(sq, occupied) & bishopsQueens) |
+		(genRookMoves(sq, occupied) & rooksQueens)
+}
+
+// SEE statically evaluates the exchange a capture starts on its target
+// square, with both sides always recapturing with their least valuable
+// attacker and free to stop capturing when it doesn't pay off. Returns the
+// material balance of the exchange for the side making the move.
+func SEE(pos *BoardStruct, move Move) int {
+	from := move.FromSq()
+	to := move.ToSq()
+
+	var gain [32]int
+	depth := 0
+
+	occupied := pos.Sides[Both]
+	side := pos.SideToMove
+	attacker := pos.Squares[from]
+
+	if move.MoveType() == Attack && move.Flag() == AttackEP {
+		gain[0] = SeePieceVal[wPawn]
+
+		if side == White {
+			occupied.ClearBit(to - 8)
+		} else {
+			occupied.ClearBit(to + 8)
+		}
+	} else {
+		gain[0] = SeePieceVal[pos.Squares[to]]
+	}
+
+	if move.MoveType() == Promotion {
+		attacker = AllPieces[side][Knight+move.Flag()]
+		gain[0] += SeePieceVal[attacker] - SeePieceVal[wPawn]
+	}
+
+	attackers := attackersTo(pos, to, occupied)
+	fromBB := SetMask[from]
+
+	for fromBB != 0 {
+		depth++
+		side ^= 1
+
+		// The value of the piece on the square, if the side to move now
+		// goes on to capture it.
+		gain[depth] = SeePieceVal[attacker] - gain[depth-1]
+
+		occupied &= ^fromBB
+		attackers = attackersTo(pos, to, occupied) & occupied
+
+		fromBB, attacker = leastValuableAttacker(pos, attackers, side)
+
+		// A king may only recapture when the square isn't defended anymore.
+		if PieceKing[attacker] && attackers&pos.Sides[side^1] != 0 {
+			break
+		}
+	}
+
+	for depth--; depth > 0; depth-- {
+		gain[depth-1] = -max(-gain[depth-1], gain[depth])
+	}
+
+	return gain[0]
+}
+
+// Find the least valuable piece of the side among the attackers.
+func leastValuableAttacker(pos *BoardStruct, attackers Bitboard, side uint8) (Bitboard, uint8) {
+	for pieceType := Pawn; pieceType <= King; pieceType++ {
+		piece := AllPieces[side][pieceType]
+		pieceBB := attackers & pos.Pieces[piece]
+
+		if pieceBB != 0 {
+			return pieceBB & -pieceBB, piece
+		}
+	}
+
+	return 0, Empty
+}
@@ -0,0 +1,47 @@
+package engine
+
+import "testing"
+
+func TestSEE(t *testing.T) {
+	tests := []struct {
+		name string
+		fen  string
+		move string
+		want int
+	}{
+		{"undefended pawn", "1k1r4/1pp4p/p7/4p3/8/P5P1/1PP4P/2K1R3 w - - 0 1", "e1e5", 100},
+		{"pawn defended by a pawn", "4k3/8/3p4/4p3/8/8/8/4QK2 w - - 0 1", "e1e5", -800},
+		{"knight for a pawn", "4k3/8/3p4/4p3/8/5N2/8/4K3 w - - 0 1", "f3e5", -220},
+		{"pawn takes knight", "4k3/8/3n4/4P3/8/8/8/4K3 w - - 0 1", "e5d6", 320},
+		{"equal trade", "4k3/8/1p6/r7/8/8/8/R3K3 w - - 0 1", "a1a5", 0},
+
+		// The rook behind the first one only attacks once the first one has
+		// captured.
+		{"x-ray attacker", "4r1k1/8/8/8/4p3/8/4R3/4R1K1 w - - 0 1", "e2e4", 100},
+		{"x-ray defender", "4r1k1/4r3/8/8/4p3/8/4R3/4R1K1 w - - 0 1", "e2e4", -400},
+		{"x-ray through the queen", "3r3k/8/8/3p4/8/5B2/6Q1/6K1 w - - 0 1", "f3d5", 100},
+		{"queen trade through the x-ray", "3q2k1/3r4/8/3p4/8/8/3R4/3Q2K1 w - - 0 1", "d2d5", -400},
+
+		{"en passant", "4k3/8/8/3pP3/8/8/8/4K3 w - d6 0 1", "e5d6", 100},
+		{"en passant into a recapture", "4k3/2p5/8/3pP3/8/8/8/4K3 w - d6 0 1", "e5d6", 0},
+		{"promotion", "1r2k3/P7/8/8/8/8/8/4K3 w - - 0 1", "a7b8q", 1300},
+		{"promotion taken by the king", "1rk5/P7/8/8/8/8/8/4K3 w - - 0 1", "a7b8q", 400},
+		{"king can't take a defended piece", "1rk5/P7/8/8/8/8/8/1R2K3 w - - 0 1", "a7b8q", 1300},
+		{"quiet promotion", "4k3/P7/8/8/8/8/8/4K3 w - - 0 1", "a7a8q", 800},
+		{"black to move", "4k3/8/8/3p4/4P3/8/8/4K3 b - - 0 1", "d5e4", 100},
+	}
+
+	for _, test := range tests {
+		pos := mustParseFen(t, test.fen)
+
+		move := ParseMove(test.move, pos)
+		if move == NoMove {
+			t.Errorf("%s: %s isn't legal", test.name, test.move)
+			continue
+		}
+
+		if see := SEE(pos, move); see != test.want {
+			t.Errorf("%s: SEE(%s) = %d, want %d", test.name, test.move, see, test.want)
+		}
+	}
+}
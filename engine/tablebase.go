@@ -0,0 +1,493 @@
+package engine
+
+import (
+	"bufio"
+	"compress/flate"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Endgame tablebases, generated by GenerateTablebase. A table holds the
+// distance to mate of every position of one material signature, such as
+// KQvKR, in one byte per position: 0 for a draw, tbInvalid for an index
+// that isn't a legal position, and the distance to mate in plies plus one
+// otherwise. An even distance means the side to move gets mated, an odd
+// one that it mates. Mates further away than tbMaxDTM plies are stored as
+// tbWinBeyond or tbLossBeyond, without their distance.
+//
+// Positions are indexed by the side to move and the squares of the
+// pieces, the white king first, then the black king and the other pieces
+// of White and Black. The board is mirrored so the white king is always on
+// the files A to D, and without pawns also flipped so it is on or below
+// the A1-D4 diagonal.
+const (
+	TBMaxPieces = 5
+
+	tbDraw       = 0
+	tbMaxDTM     = 251
+	tbWinBeyond  = 253
+	tbLossBeyond = 254
+	tbInvalid    = 255
+
+	// The directory tables are generated in if no TablebasePath is set.
+	DefaultTablebasePath = "tablebases"
+
+	tbFileMagic = "PTB2"
+	tbFileExt   = ".ptb"
+)
+
+// The results of a tablebase probe, from the side to move's point of view.
+const (
+	TBLoss = iota
+	TBDraw
+	TBWin
+)
+
+// The order of the non-king pieces within a side, strongest first.
+var tbPieceOrder = []uint8{Queen, Rook, Bishop, Knight, Pawn}
+
+var tbPieceChar = [7]byte{0, 'P', 'N', 'B', 'R', 'Q', 'K'}
+
+// Table is the tablebase of one material signature.
+type Table struct {
+	Name string
+
+	// The pieces in index order, as seen from the table: the kings first,
+	// then the other white and black pieces.
+	pieces []uint8
+
+	pawns       bool
+	kingSquares []int
+	kingIndex   [64]int
+
+	Data []byte
+}
+
+// A table together with whether the position has to be color flipped to
+// look it up.
+type tbRef struct {
+	table   *Table
+	flipped bool
+}
+
+// The loaded and generated tables, by the material key of the positions
+// they cover. Each table is found under both color orientations.
+var tablebases = make(map[uint64]tbRef)
+
+// Get a key identifying the material on the board.
+func materialKey(pos *BoardStruct) uint64 {
+	key := uint64(0)
+
+	for piece := wPawn; piece <= bKing; piece++ {
+		key |= uint64(pos.Pieces[piece].CountBits()) << (4 * piece)
+	}
+
+	return key
+}
+
+// Parse a material signature like "KQvKR" into the white and black piece
+// types, king first and the other pieces strongest first.
+func parseSignature(name string) ([2][]uint8, error) {
+	var sides [2][]uint8
+
+	parts := strings.Split(strings.ToUpper(name), "V")
+	if len(parts) != 2 {
+		return sides, fmt.Errorf("invalid material signature %s", name)
+	}
+
+	total := 0
+
+	for side, part := range parts {
+		if !strings.HasPrefix(part, "K") || strings.Count(part, "K") != 1 {
+			return sides, fmt.Errorf("invalid material signature %s", name)
+		}
+
+		sides[side] = []uint8{King}
+
+		for _, pieceType := range tbPieceOrder {
+			for i := strings.Count(part, string(tbPieceChar[pieceType])); i > 0; i-- {
+				sides[side] = append(sides[side], pieceType)
+			}
+		}
+
+		if len(sides[side]) != len(part) {
+			return sides, fmt.Errorf("invalid material signature %s", name)
+		}
+
+		total += len(part)
+	}
+
+	if total > TBMaxPieces {
+		return sides, fmt.Errorf("%s has more than %d pieces", name, TBMaxPieces)
+	}
+
+	return sides, nil
+}
+
+// Get the name of the signature, with the stronger side as White so each
+// signature has just one table.
+func signatureName(sides [2][]uint8) string {
+	names := [2]string{}
+	values := [2]int{}
+
+	for side := range sides {
+		for _, pieceType := range sides[side] {
+			names[side] += string(tbPieceChar[pieceType])
+			values[side] += PieceVal[pieceType]
+		}
+	}
+
+	if values[Black] > values[White] || (values[Black] == values[White] && names[Black] > names[White]) {
+		names[White], names[Black] = names[Black], names[White]
+	}
+
+	return names[White] + "v" + names[Black]
+}
+
+func newTable(name string) (*Table, error) {
+	sides, err := parseSignature(name)
+	if err != nil {
+		return nil, err
+	}
+
+	if signatureName(sides) != name {
+		return nil, fmt.Errorf("%s isn't a canonical material signature", name)
+	}
+
+	table := &Table{Name: name}
+	table.pieces = []uint8{wKing, bKing}
+
+	for side := White; side <= Black; side++ {
+		for _, pieceType := range sides[side][1:] {
+			table.pieces = append(table.pieces, AllPieces[side][pieceType])
+			table.pawns = table.pawns || pieceType == Pawn
+		}
+	}
+
+	for sq := 0; sq < 64; sq++ {
+		table.kingIndex[sq] = -1
+
+		if table.pawns && FileOf(sq) <= FD || !table.pawns && FileOf(sq) <= FD && RankOf(sq) <= FileOf(sq) {
+			table.kingIndex[sq] = len(table.kingSquares)
+			table.kingSquares = append(table.kingSquares, sq)
+		}
+	}
+
+	return table, nil
+}
+
+// Get the number of positions of the table.
+func (t *Table) size() int {
+	size := 2 * len(t.kingSquares)
+
+	for range t.pieces[1:] {
+		size *= 64
+	}
+
+	return size
+}
+
+// The key of the material of the table, and of its color flipped version.
+func (t *Table) materialKeys() (uint64, uint64) {
+	var key, flippedKey uint64
+
+	for _, piece := range t.pieces {
+		key += 1 << (4 * piece)
+		flippedKey += 1 << (4 * AllPieces[PieceCol[piece]^1][(piece-1)%6+1])
+	}
+
+	return key, flippedKey
+}
+
+func (t *Table) register() {
+	key, flippedKey := t.materialKeys()
+
+	tablebases[key] = tbRef{table: t}
+	if flippedKey != key {
+		tablebases[flippedKey] = tbRef{table: t, flipped: true}
+	}
+}
+
+// Get the index of the position with the pieces on the squares, given in
+// the order of the table.
+func (t *Table) index(stm uint8, squares []int) int {
+	kingSq := squares[0]
+
+	transform := 0
+	if FileOf(kingSq) > FD {
+		transform |= 1
+	}
+	if !t.pawns && RankOf(kingSq) > R4 {
+		transform |= 2
+	}
+
+	if t.pawns {
+		return t.transformedIndex(stm, squares, transform)
+	}
+
+	switch kingSq = transformSquare(kingSq, transform); {
+	case RankOf(kingSq) > FileOf(kingSq):
+		transform |= 4
+	case RankOf(kingSq) == FileOf(kingSq):
+		// With the king on the diagonal both the position and its
+		// mirror image are in the table's orientation, the one with the
+		// lower index is used.
+		return min(t.transformedIndex(stm, squares, transform), t.transformedIndex(stm, squares, transform|4))
+	}
+
+	return t.transformedIndex(stm, squares, transform)
+}
+
+func (t *Table) transformedIndex(stm uint8, squares []int, transform int) int {
+	var transformed [TBMaxPieces]int
+
+	for i, sq := range squares {
+		transformed[i] = transformSquare(sq, transform)
+	}
+
+	// Pieces of the same kind are interchangeable, sort them so the
+	// position only has one index.
+	for i := 1; i < len(squares); i++ {
+		for j := i; j > 0 && t.pieces[j] == t.pieces[j-1] && transformed[j] < transformed[j-1]; j-- {
+			transformed[j], transformed[j-1] = transformed[j-1], transformed[j]
+		}
+	}
+
+	index := int(stm)*len(t.kingSquares) + t.kingIndex[transformed[0]]
+	for _, sq := range transformed[1:len(squares)] {
+		index = index*64 + sq
+	}
+
+	return index
+}
+
+// Mirror the square by the file, then the rank and then the A1-H8 diagonal,
+// each if the respective bit of the transform is set.
+func transformSquare(sq int, transform int) int {
+	if transform&1 != 0 {
+		sq ^= 7
+	}
+	if transform&2 != 0 {
+		sq ^= 56
+	}
+	if transform&4 != 0 {
+		sq = FileOf(sq)*8 + RankOf(sq)
+	}
+	return sq
+}
+
+// Find the table of the position, and get the side to move and the
+// squares of its pieces as seen from the table.
+func tbLookup(pos *BoardStruct, squares []int) (*Table, uint8, []int) {
+	ref, ok := tablebases[materialKey(pos)]
+	if !ok {
+		return nil, 0, nil
+	}
+
+	table := ref.table
+	squares = squares[:len(table.pieces)]
+
+	var pieces [13]Bitboard
+	copy(pieces[:], pos.Pieces[:])
+
+	for i, piece := range table.pieces {
+		if ref.flipped {
+			piece = AllPieces[PieceCol[piece]^1][(piece-1)%6+1]
+		}
+
+		squares[i] = pieces[piece].PopBit()
+
+		if ref.flipped {
+			squares[i] ^= 56
+		}
+	}
+
+	stm := pos.SideToMove
+	if ref.flipped {
+		stm ^= 1
+	}
+
+	return table, stm, squares
+}
+
+// ProbeTablebase looks the position up in the tablebases. It returns the
+// result for the side to move and the number of plies to mate, or false
+// if there is no table for the position. The tables don't know about
+// castling and en passant, so positions where they are possible aren't
+// probed.
+func ProbeTablebase(pos *BoardStruct) (int, int, bool) {
+	if pos.CastlePerm != 0 || pos.Sides[Both].CountBits() > TBMaxPieces {
+		return 0, 0, false
+	}
+
+	if pos.EnPas != NoSq && PawnAttacks[pos.SideToMove][pos.EnPas]&pos.Pawns[pos.SideToMove] != 0 {
+		return 0, 0, false
+	}
+
+	var buffer [TBMaxPieces]int
+
+	table, stm, squares := tbLookup(pos, buffer[:])
+	if table == nil || table.Data == nil {
+		return 0, 0, false
+	}
+
+	result, dtm := tbDecode(table.Data[table.index(stm, squares)])
+	return result, dtm, true
+}
+
+// Get the result and the distance to mate of a table value. Mates beyond
+// the range of distances are given the distance tbMaxDTM+1, the closest
+// they can be.
+func tbDecode(value byte) (int, int) {
+	switch {
+	case value == tbDraw || value == tbInvalid:
+		return TBDraw, 0
+	case value == tbWinBeyond:
+		return TBWin, tbMaxDTM + 1
+	case value == tbLossBeyond:
+		return TBLoss, tbMaxDTM + 1
+	case (value-1)%2 == 0:
+		return TBLoss, int(value - 1)
+	default:
+		return TBWin, int(value - 1)
+	}
+}
+
+// Get the search score of a tablebase result at the ply. Mates too far
+// away to be told apart from other scores are scored just below mates.
+func tbScore(result int, dtm int, ply int) int {
+	score := MateScore - ply - dtm
+	if ply+dtm >= MaxDepth {
+		score = ISMATE - 1 - dtm
+	}
+
+	switch result {
+	case TBWin:
+		return score
+	case TBLoss:
+		return -score
+	}
+
+	return 0
+}
+
+// Score the moves of the position from the tablebases, best first: the
+// fastest mates when winning, the drawing moves when drawing and the
+// slowest mates when losing. Returns nil if the position, or one it leads
+// to, isn't in the tablebases. Mates beyond the range of distances keep
+// their result but can't be told apart, so the move chosen there may not
+// make progress.
+func tablebaseLines(pos *BoardStruct) []rootLine {
+	if _, _, ok := ProbeTablebase(pos); !ok {
+		return nil
+	}
+
+	var list MoveList
+	GenerateLegalMoveList(pos, &list)
+
+	lines := make([]rootLine, 0, list.Count)
+
+	for moveNum := 0; moveNum < list.Count; moveNum++ {
+		move := list.Moves[moveNum]
+
+		pos.DoMove(move)
+		result, dtm, ok := ProbeTablebase(pos)
+		pos.UndoMove()
+
+		if !ok {
+			return nil
+		}
+
+		lines = append(lines, rootLine{-tbScore(result, dtm, 1), []Move{move}})
+	}
+
+	sort.SliceStable(lines, func(i, j int) bool {
+		return lines[i].score > lines[j].score
+	})
+
+	return lines
+}
+
+// LoadTablebases loads all tables of the directory, replacing the tables
+// loaded before.
+func LoadTablebases(dir string) (int, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*"+tbFileExt))
+	if err != nil {
+		return 0, err
+	}
+
+	tablebases = make(map[uint64]tbRef)
+
+	for _, path := range paths {
+		table, err := loadTable(path)
+		if err != nil {
+			return 0, err
+		}
+
+		table.register()
+	}
+
+	return len(paths), nil
+}
+
+func loadTable(path string) (*Table, error) {
+	table, err := newTable(strings.TrimSuffix(filepath.Base(path), tbFileExt))
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	reader := bufio.NewReader(file)
+
+	magic := make([]byte, len(tbFileMagic))
+	if _, err := io.ReadFull(reader, magic); err != nil || string(magic) != tbFileMagic {
+		return nil, fmt.Errorf("%s isn't a tablebase file", path)
+	}
+
+	table.Data = make([]byte, table.size())
+
+	if _, err := io.ReadFull(flate.NewReader(reader), table.Data); err != nil {
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			return nil, fmt.Errorf("%s is truncated", path)
+		}
+		return nil, err
+	}
+
+	return table, nil
+}
+
+func (t *Table) save(dir string) error {
+	file, err := os.Create(filepath.Join(dir, t.Name+tbFileExt))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	writer := bufio.NewWriter(file)
+	writer.WriteString(tbFileMagic)
+
+	compressor, err := flate.NewWriter(writer, flate.BestCompression)
+	if err != nil {
+		return err
+	}
+
+	if _, err := compressor.Write(t.Data); err != nil {
+		return err
+	}
+
+	if err := compressor.Close(); err != nil {
+		return err
+	}
+
+	return writer.Flush()
+}
@@ -0,0 +1,123 @@
+package engine
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestGenerateTablebase(t *testing.T) {
+	defer func(loaded map[uint64]tbRef) { tablebases = loaded }(tablebases)
+
+	type probe struct {
+		fen    string
+		result int
+		dtm    int
+	}
+
+	tests := []struct {
+		name    string
+		tables  int
+		longest int
+		probes  []probe
+	}{
+		{"KQvK", 2, 20, []probe{
+			{"k7/1Q6/2K5/8/8/8/8/8 b - - 0 1", TBLoss, 0},
+			{"K7/1q6/2k5/8/8/8/8/8 w - - 0 1", TBLoss, 0},
+			{"k7/8/1K6/8/8/8/8/6Q1 w - - 0 1", TBWin, 1},
+			{"K7/8/1k6/8/8/8/8/6q1 b - - 0 1", TBWin, 1},
+			{"k7/8/1Q6/8/8/8/8/2K5 b - - 0 1", TBDraw, 0},
+			{"K7/8/1q6/8/8/8/8/2k5 w - - 0 1", TBDraw, 0},
+			{"k7/1Q6/8/8/8/8/8/7K b - - 0 1", TBDraw, 0},
+		}},
+		{"KRvK", 2, 32, []probe{
+			{"k6R/8/K7/8/8/8/8/8 b - - 0 1", TBLoss, 0},
+			{"K6r/8/k7/8/8/8/8/8 w - - 0 1", TBLoss, 0},
+			{"k7/8/K7/8/8/8/8/7R w - - 0 1", TBWin, 1},
+			{"K7/8/k7/8/8/8/8/7r b - - 0 1", TBWin, 1},
+			{"k7/1R6/8/8/8/8/8/7K b - - 0 1", TBDraw, 0},
+		}},
+	}
+
+	for _, test := range tests {
+		tablebases = make(map[uint64]tbRef)
+		dir := t.TempDir()
+
+		if err := GenerateTablebase(test.name, dir); err != nil {
+			t.Fatal(err)
+		}
+
+		generated := make(map[string][]byte)
+		for _, ref := range tablebases {
+			generated[ref.table.Name] = ref.table.Data
+		}
+
+		longest := 0
+		for _, value := range generated[test.name] {
+			if _, dtm := tbDecode(value); dtm > longest {
+				longest = dtm
+			}
+		}
+
+		if longest != test.longest {
+			t.Errorf("%s: longest mate %d plies, want %d", test.name, longest, test.longest)
+		}
+
+		checkProbes := func(when string) {
+			for _, probe := range test.probes {
+				pos := mustParseFen(t, probe.fen)
+
+				result, dtm, ok := ProbeTablebase(pos)
+				if !ok || result != probe.result || dtm != probe.dtm {
+					t.Errorf("%s %s: probe of %s = %d %d %t, want %d %d true", test.name, when,
+						probe.fen, result, dtm, ok, probe.result, probe.dtm)
+				}
+			}
+		}
+
+		checkProbes("generated")
+
+		// The saved tables load back to the same data.
+		count, err := LoadTablebases(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if count != test.tables || len(generated) != test.tables {
+			t.Errorf("%s: %d tables loaded from %d generated, want %d", test.name, count, len(generated), test.tables)
+		}
+
+		for _, ref := range tablebases {
+			if !bytes.Equal(ref.table.Data, generated[ref.table.Name]) {
+				t.Errorf("%s: loaded table %s differs from the generated one", test.name, ref.table.Name)
+			}
+		}
+
+		checkProbes("loaded")
+	}
+
+	// At the root, the mates in one come first, Qg8 among them.
+	tablebases = make(map[uint64]tbRef)
+	if err := GenerateTablebase("KQvK", t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+
+	pos := mustParseFen(t, "k7/8/1K6/8/8/8/8/6Q1 w - - 0 1")
+	qg8 := ParseMove("g1g8", pos)
+
+	lines := tablebaseLines(pos)
+	found := false
+
+	for i, line := range lines {
+		if i > 0 && line.score > lines[i-1].score {
+			t.Errorf("tablebase root line %d scored %d after %d", i, line.score, lines[i-1].score)
+		}
+
+		if line.pv[0].Equal(qg8) {
+			found = line.score == MateScore-1 && lines[0].score == MateScore-1
+		}
+	}
+
+	if !found {
+		t.Errorf("tablebase root lines %v, want g1g8 as a mate in one first", lines)
+	}
+}
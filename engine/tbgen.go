@@ -0,0 +1,384 @@
+package engine
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// GenerateTablebase generates the table of the material signature by
+// retrograde analysis and writes it to the directory, along with the
+// tables of all signatures it can convert into by captures and promotions
+// that aren't loaded yet.
+//
+// All positions are examined once to find the mates and the captures and
+// promotions into already solved tables. From then on, the positions are
+// solved in order of their distance to mate: once the positions n plies
+// from mate are known, only the positions with a move into one of them
+// can turn out to be n+1 plies from mate, so only those are examined
+// again. What is left unsolved at the end is a draw.
+func GenerateTablebase(name string, dir string) error {
+	sides, err := parseSignature(name)
+	if err != nil {
+		return err
+	}
+
+	name = signatureName(sides)
+
+	if ref, ok := tablebases[signatureKey(sides)]; ok && ref.table.Data != nil {
+		return nil
+	}
+
+	for _, child := range childSignatures(sides) {
+		if err := GenerateTablebase(child, dir); err != nil {
+			return err
+		}
+	}
+
+	table, err := newTable(name)
+	if err != nil {
+		return err
+	}
+
+	start := time.Now()
+	fmt.Printf("Generating %s, %d positions\n", name, table.size())
+
+	table.Data = make([]byte, table.size())
+	table.register()
+
+	gen := tbGenerator{table: table, pos: new(BoardStruct)}
+	gen.pos.ResetBoard()
+	gen.run()
+
+	fmt.Printf("Generated %s in %v, longest mate %d plies\n", name, time.Since(start).Round(time.Millisecond), gen.longest)
+
+	if gen.beyondCount > 0 {
+		fmt.Printf("%d positions are mates beyond %d plies, stored without their distance\n", gen.beyondCount, tbMaxDTM)
+	}
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+
+	if err := table.save(dir); err != nil {
+		return err
+	}
+
+	fmt.Printf("Written to %s\n", filepath.Join(dir, name+tbFileExt))
+	return nil
+}
+
+func signatureKey(sides [2][]uint8) uint64 {
+	key := uint64(0)
+
+	for side := White; side <= Black; side++ {
+		for _, pieceType := range sides[side] {
+			key += 1 << (4 * AllPieces[side][pieceType])
+		}
+	}
+
+	return key
+}
+
+// Get the signatures a position of the signature can turn into by a
+// capture or a promotion.
+func childSignatures(sides [2][]uint8) []string {
+	var children []string
+
+	for side := range sides {
+		for i, pieceType := range sides[side] {
+			if pieceType == King {
+				continue
+			}
+
+			child := sides
+			child[side] = append(append([]uint8{}, sides[side][:i]...), sides[side][i+1:]...)
+			children = append(children, signatureName(child))
+
+			if pieceType == Pawn {
+				for _, promoted := range []uint8{Queen, Rook, Bishop, Knight} {
+					promotion := child
+					promotion[side] = append(append([]uint8{}, child[side]...), promoted)
+					children = append(children, signatureName(promotion))
+				}
+			}
+		}
+	}
+
+	return children
+}
+
+type tbGenerator struct {
+	table *Table
+	pos   *BoardStruct
+
+	squares [TBMaxPieces]int
+	longest int
+
+	// Set once the distances run out of range, and the number of positions
+	// stored as wins or losses beyond it.
+	beyond      bool
+	beyondCount int
+
+	// The positions to examine at the current and the next distance, and
+	// the positions whose distance is already known to be further away.
+	current []int
+	next    []int
+	queued  []bool
+	later   map[int][]int
+}
+
+func (gen *tbGenerator) run() {
+	size := gen.table.size()
+
+	gen.queued = make([]bool, size)
+	gen.later = make(map[int][]int)
+
+	for index := 0; index < size; index++ {
+		if !gen.setup(index) {
+			gen.table.Data[index] = tbInvalid
+			continue
+		}
+
+		gen.examine(index, 0)
+		gen.clear()
+	}
+
+	for dtm := 1; dtm <= tbMaxDTM && (len(gen.next) > 0 || len(gen.later) > 0); dtm++ {
+		gen.current, gen.next = gen.next, gen.current[:0]
+		gen.current = append(gen.current, gen.later[dtm]...)
+		delete(gen.later, dtm)
+
+		gen.examineCurrent(dtm)
+	}
+
+	// What is still waiting is decided beyond the range of distances.
+	// From here on only wins and losses are told apart, so the positions
+	// are examined until nothing changes anymore.
+	gen.beyond = true
+
+	for _, indexes := range gen.later {
+		gen.next = append(gen.next, indexes...)
+	}
+	gen.later = nil
+
+	for len(gen.next) > 0 {
+		gen.current, gen.next = gen.next, gen.current[:0]
+		gen.examineCurrent(tbMaxDTM)
+	}
+}
+
+func (gen *tbGenerator) examineCurrent(dtm int) {
+	for _, index := range gen.current {
+		gen.queued[index] = false
+	}
+
+	for _, index := range gen.current {
+		if gen.table.Data[index] != tbDraw {
+			continue
+		}
+
+		gen.setup(index)
+		gen.examine(index, dtm)
+		gen.clear()
+	}
+}
+
+// Set up the position of the index on the board. Reports false if the
+// index doesn't stand for a legal position in its canonical orientation.
+func (gen *tbGenerator) setup(index int) bool {
+	table := gen.table
+	pos := gen.pos
+	squares := gen.squares[:len(table.pieces)]
+
+	rest := index
+	for i := len(squares) - 1; i > 0; i-- {
+		squares[i] = rest % 64
+		rest /= 64
+	}
+
+	squares[0] = table.kingSquares[rest%len(table.kingSquares)]
+	stm := uint8(rest / len(table.kingSquares))
+
+	for i, sq := range squares {
+		if pos.Squares[sq] != Empty || PiecePawn[table.pieces[i]] && (RankOf(sq) == R1 || RankOf(sq) == R8) {
+			gen.clear()
+			return false
+		}
+
+		pos.AddPiece(sq, table.pieces[i])
+	}
+
+	pos.SideToMove = stm
+
+	var buffer [TBMaxPieces]int
+	_, _, canonical := tbLookup(pos, buffer[:])
+
+	if table.index(stm, canonical) != index {
+		gen.clear()
+		return false
+	}
+
+	if SqAttacked(pos.Pieces[AllPieces[stm^1][King]].Msb(), pos, stm) {
+		gen.clear()
+		return false
+	}
+
+	return true
+}
+
+// Remove all pieces from the board.
+func (gen *tbGenerator) clear() {
+	for sq := 0; sq < 64; sq++ {
+		if gen.pos.Squares[sq] != Empty {
+			gen.pos.ClearPiece(sq)
+		}
+	}
+}
+
+// Find the distance to mate of the position at the index as far as the
+// positions it leads to are solved. The result is stored if it is the
+// distance being solved, and the position is set aside if it is further.
+// Once beyond the range of distances, wins and losses are stored as soon
+// as they are known.
+func (gen *tbGenerator) examine(index int, dtm int) {
+	pos := gen.pos
+
+	var list MoveList
+	GenerateLegalMoveList(pos, &list)
+
+	// The fastest mate found, and the slowest mate against the side to
+	// move as long as all moves lose.
+	win := 0
+	loss := 0
+	allLose := true
+
+	for moveNum := 0; moveNum < list.Count; moveNum++ {
+		pos.DoMove(list.Moves[moveNum])
+		result, childDTM := tbDecode(gen.probe())
+		pos.UndoMove()
+
+		switch result {
+		case TBDraw:
+			allLose = false
+		case TBLoss:
+			if win == 0 || childDTM+1 < win {
+				win = childDTM + 1
+			}
+			allLose = false
+		case TBWin:
+			loss = max(loss, childDTM+1)
+		}
+	}
+
+	found := loss
+	if list.Count == 0 && !pos.InCheck() {
+		return
+	} else if win > 0 {
+		found = win
+	} else if !allLose {
+		return
+	}
+
+	if found > tbMaxDTM && gen.beyond {
+		if win > 0 {
+			gen.table.Data[index] = tbWinBeyond
+		} else {
+			gen.table.Data[index] = tbLossBeyond
+		}
+
+		gen.beyondCount++
+		gen.queuePredecessors()
+		return
+	}
+
+	if found > dtm {
+		gen.later[found] = append(gen.later[found], index)
+		return
+	}
+
+	gen.table.Data[index] = byte(found + 1)
+	gen.longest = max(gen.longest, found)
+	gen.queuePredecessors()
+}
+
+// Get the value of the position on the board, which either belongs to the
+// table being generated or to a table it converts into.
+func (gen *tbGenerator) probe() byte {
+	var buffer [TBMaxPieces]int
+
+	table, stm, squares := tbLookup(gen.pos, buffer[:])
+	if table == nil {
+		return tbDraw
+	}
+
+	return table.Data[table.index(stm, squares)]
+}
+
+// Queue the positions of the table that lead to the position on the board
+// by a move of the side that isn't to move. Captures and promotions lead
+// to other tables, so it is enough to move a piece back to an empty
+// square.
+func (gen *tbGenerator) queuePredecessors() {
+	pos := gen.pos
+	mover := pos.SideToMove ^ 1
+	empty := ^pos.Sides[Both]
+
+	pieces := pos.Sides[mover]
+
+	for pieces != 0 {
+		to := pieces.PopBit()
+		piece := pos.Squares[to]
+
+		var froms Bitboard
+
+		switch piece {
+		case wPawn:
+			if from := to - 8; RankOf(from) >= R2 && empty&SetMask[from] != 0 {
+				froms |= SetMask[from]
+
+				if RankOf(to) == R4 && empty&SetMask[from-8] != 0 {
+					froms |= SetMask[from-8]
+				}
+			}
+		case bPawn:
+			if from := to + 8; RankOf(from) <= R7 && empty&SetMask[from] != 0 {
+				froms |= SetMask[from]
+
+				if RankOf(to) == R5 && empty&SetMask[from+8] != 0 {
+					froms |= SetMask[from+8]
+				}
+			}
+		case wKnight, bKnight:
+			froms = KnightAttacks[to] & empty
+		case wBishop, bBishop:
+			froms = genBishopMoves(to, pos.Sides[Both]) & empty
+		case wRook, bRook:
+			froms = genRookMoves(to, pos.Sides[Both]) & empty
+		case wQueen, bQueen:
+			froms = (genBishopMoves(to, pos.Sides[Both]) | genRookMoves(to, pos.Sides[Both])) & empty
+		case wKing, bKing:
+			froms = KingAttacks[to] & empty
+		}
+
+		for froms != 0 {
+			from := froms.PopBit()
+
+			pos.MovePiece(to, from)
+			pos.SideToMove = mover
+
+			var buffer [TBMaxPieces]int
+			_, stm, squares := tbLookup(pos, buffer[:])
+			index := gen.table.index(stm, squares)
+
+			if !gen.queued[index] && gen.table.Data[index] == tbDraw {
+				gen.queued[index] = true
+				gen.next = append(gen.next, index)
+			}
+
+			pos.SideToMove = mover ^ 1
+			pos.MovePiece(from, to)
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package engine
+
+import "time"
+
+const (
+	// The default milliseconds kept back from every move's budget to cover
+	// the delay between the engine and the GUI.
+	DefaultMoveOverhead = 50
+
+	// The number of moves the remaining time is split over when the GUI
+	// doesn't send movestogo (sudden death or increment games).
+	defaultMovesToGo = 30
+
+	// A score drop of this many centipawns between two iterations gives
+	// the search the most extra time.
+	scoreDropMargin = 100
+)
+
+// TimeManager decides how long the search may run. The soft limit is
+// checked between iterations and is stretched while the search is
+// unsure about its move. The hard limit is checked inside the search and
+// stops it no matter what, so the engine never runs out of time.
+type TimeManager struct {
+	MoveOverhead int
+
+	Starttime int64
+	Timeset   bool
+
+	// The node budget set by "go nodes", zero when there is none.
+	NodeLimit int64
+
+	softLimit int64
+	hardLimit int64
+
+	// Bookkeeping of the previous iterations used to scale the soft limit.
+	prevBest    Move
+	prevScore   int
+	instability float64
+	scoreDrop   int
+	iterations  int
+}
+
+// Start the clock for a new search. Times are in milliseconds, with -1
+// meaning the value wasn't given by the GUI.
+func (tm *TimeManager) Start(timeLeft int, inc int, movesToGo int, moveTime int) {
+	tm.Starttime = time.Now().UnixMilli()
+	tm.Timeset = false
+	tm.softLimit = 0
+	tm.hardLimit = 0
+
+	tm.prevBest = NoMove
+	tm.prevScore = 0
+	tm.instability = 0
+	tm.scoreDrop = 0
+	tm.iterations = 0
+
+	if moveTime != -1 {
+		tm.Timeset = true
+		tm.softLimit = int64(max(moveTime-tm.MoveOverhead, 1))
+		tm.hardLimit = tm.softLimit
+		return
+	}
+
+	if timeLeft == -1 {
+		return
+	}
+
+	tm.Timeset = true
+
+	if movesToGo <= 0 {
+		movesToGo = defaultMovesToGo
+	}
+
+	// Never plan to use more than most of the clock, whatever the
+	// increment, so there is always something left for the next moves.
+	remaining := max(timeLeft-tm.MoveOverhead, 1)
+	maximum := max(remaining-remaining/(movesToGo+4), 1)
+
+	soft := remaining/movesToGo + inc*3/4
+	hard := soft * 4
+
+	if movesToGo == 1 {
+		soft = maximum
+	}
+
+	tm.softLimit = int64(min(soft, maximum))
+	tm.hardLimit = int64(min(hard, maximum))
+}
+
+// Get the milliseconds passed since the search started.
+func (tm *TimeManager) Elapsed() int64 {
+	return time.Now().UnixMilli() - tm.Starttime
+}
+
+// Record the result of a completed iteration. A new best move makes the
+// search less stable, and a dropping score calls for more time to look
+// for something better.
+func (tm *TimeManager) UpdateIteration(bestMove Move, score int) {
+	tm.instability *= 0.5
+
+	if tm.iterations > 0 {
+		if !bestMove.Equal(tm.prevBest) {
+			tm.instability += 1
+		}
+		tm.scoreDrop = min(max(tm.prevScore-score, 0), scoreDropMargin)
+	}
+
+	tm.prevBest = bestMove
+	tm.prevScore = score
+	tm.iterations++
+}
+
+// SoftLimitReached reports whether another iteration shouldn't be started.
+func (tm *TimeManager) SoftLimitReached() bool {
+	if !tm.Timeset {
+		return false
+	}
+
+	scale := 1 + 0.5*tm.instability
+	scale *= 1 + 0.5*float64(tm.scoreDrop)/scoreDropMargin
+
+	soft := min(int64(float64(tm.softLimit)*scale), tm.hardLimit)
+
+	return tm.Elapsed() >= soft
+}
+
+// HardLimitReached reports whether the search has to stop right away.
+func (tm *TimeManager) HardLimitReached(nodes int64) bool {
+	if tm.NodeLimit > 0 && nodes >= tm.NodeLimit {
+		return true
+	}
+
+	return tm.Timeset && tm.Elapsed() >= tm.hardLimit
+}
+
+func (tm *TimeManager) SoftLimit() int64 {
+	return tm.softLimit
+}
+
+func (tm *TimeManager) HardLimit() int64 {
+	return tm.hardLimit
+}
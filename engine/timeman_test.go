@@ -0,0 +1,106 @@
+package engine
+
+import "testing"
+
+func TestTimeLimits(t *testing.T) {
+	tests := []struct {
+		name      string
+		timeLeft  int
+		inc       int
+		movesToGo int
+		moveTime  int
+		soft      int64
+		hard      int64
+	}{
+		{"movetime", -1, 0, -1, 1000, 950, 950},
+		{"movetime below the overhead", -1, 0, -1, 30, 1, 1},
+		{"sudden death", 60000, 0, -1, -1, 1998, 7992},
+		{"increment", 60000, 1000, -1, -1, 2748, 10992},
+		{"moves to go", 10000, 0, 10, -1, 995, 3980},
+		{"last move before the time control", 5000, 0, 1, -1, 3960, 3960},
+		{"increment above the clock", 1000, 5000, -1, -1, 923, 923},
+	}
+
+	for _, test := range tests {
+		tm := TimeManager{MoveOverhead: DefaultMoveOverhead}
+		tm.Start(test.timeLeft, test.inc, test.movesToGo, test.moveTime)
+
+		if !tm.Timeset || tm.SoftLimit() != test.soft || tm.HardLimit() != test.hard {
+			t.Errorf("%s: soft %d hard %d timeset %t, want %d %d true", test.name,
+				tm.SoftLimit(), tm.HardLimit(), tm.Timeset, test.soft, test.hard)
+		}
+	}
+
+	tm := TimeManager{MoveOverhead: DefaultMoveOverhead}
+	tm.Start(-1, 0, -1, -1)
+	tm.Starttime -= 1_000_000
+
+	if tm.Timeset || tm.SoftLimitReached() || tm.HardLimitReached(1_000_000) {
+		t.Errorf("infinite search limited")
+	}
+}
+
+func TestSoftLimitScaling(t *testing.T) {
+	e4 := NewMove(E2, E4, Quiet, DoublePawnPush)
+	d4 := NewMove(D2, D4, Quiet, DoublePawnPush)
+
+	type iteration struct {
+		move  Move
+		score int
+	}
+
+	// The soft limit of 1998ms is stretched by half for each recent change
+	// of the best move and up to half for a dropping score, but never past
+	// the hard limit of 7992ms.
+	tests := []struct {
+		name       string
+		iterations []iteration
+		elapsed    int64
+		reached    bool
+	}{
+		{"before the soft limit", []iteration{{e4, 20}, {e4, 25}}, 1900, false},
+		{"stable move", []iteration{{e4, 20}, {e4, 25}}, 2000, true},
+		{"new best move", []iteration{{e4, 20}, {d4, 25}}, 2000, false},
+		{"new best move past the longer limit", []iteration{{e4, 20}, {d4, 25}}, 3000, true},
+		{"dropping score", []iteration{{e4, 20}, {e4, -80}}, 2900, false},
+		{"dropping score past the longer limit", []iteration{{e4, 20}, {e4, -80}}, 3000, true},
+		{"old change of the best move", []iteration{{e4, 20}, {d4, 20}, {d4, 20}, {d4, 20}}, 2300, true},
+		{"unstable past the hard limit", []iteration{{e4, 400}, {d4, 0}, {e4, -200}, {d4, -400}}, 7992, true},
+	}
+
+	for _, test := range tests {
+		tm := TimeManager{MoveOverhead: DefaultMoveOverhead}
+		tm.Start(60000, 0, -1, -1)
+
+		for _, it := range test.iterations {
+			tm.UpdateIteration(it.move, it.score)
+		}
+
+		tm.Starttime -= test.elapsed
+
+		if reached := tm.SoftLimitReached(); reached != test.reached {
+			t.Errorf("%s: soft limit reached %t at %dms, want %t", test.name, reached, test.elapsed, test.reached)
+		}
+	}
+}
+
+func TestHardLimit(t *testing.T) {
+	tm := TimeManager{MoveOverhead: DefaultMoveOverhead}
+	tm.Start(-1, 0, -1, 500)
+
+	if tm.HardLimitReached(0) {
+		t.Errorf("hard limit reached right after the start")
+	}
+
+	tm.Starttime -= 450
+	if !tm.HardLimitReached(0) {
+		t.Errorf("hard limit not reached after 450ms of a 500ms move time")
+	}
+
+	tm.Start(-1, 0, -1, -1)
+	tm.NodeLimit = 10000
+
+	if tm.HardLimitReached(9999) || !tm.HardLimitReached(10000) {
+		t.Errorf("node limit of 10000 not applied")
+	}
+}
@@ -1,44 +1,170 @@
 package engine
 
+import "sync/atomic"
+
 const (
 	DefaultTableSize = 64
-	SearchEntrySize  = 12
+	SearchEntrySize  = 16
+
+	// Constants representing the kind of bound an entry's score is. An
+	// alpha flag marks an upper bound (no move raised alpha), a beta flag a
+	// lower bound (the node failed high) and an exact flag a pv score.
+	NoFlagTT  uint8 = 0
+	AlphaFlag uint8 = 1
+	BetaFlag  uint8 = 2
+	ExactFlag uint8 = 3
 )
 
+// The table is shared by all search threads without any locking. Each slot
+// stores the entry packed into a single data word, and the hash xor-ed with
+// that word as its key. A slot torn by two threads writing at once then
+// simply fails the hash check when probed, instead of returning data that
+// belongs to another position.
 type TranspositionTable struct {
-	Entries []SearchEntry
+	Entries []ttSlot
 	Size    uint64
+
+	// The generation of the current search, used to recognize entries
+	// left over from earlier searches when deciding what to replace.
+	Age uint8
+}
+
+type ttSlot struct {
+	key  uint64
+	data uint64
 }
 
 type SearchEntry struct {
-	Hash uint64
-	Best Move
+	Hash  uint64
+	Best  Move
+	Score int16
+	Depth int8
+	Flag  uint8
+	Age   uint8
 }
 
 func (tt *TranspositionTable) InitTransTable(sizeMB uint64) {
 	size := (sizeMB * 1024 * 1024) / SearchEntrySize
 
-	tt.Entries = make([]SearchEntry, size)
+	tt.Entries = make([]ttSlot, size)
 	tt.Size = size
+	tt.Age = 0
 }
 
-func (tt *TranspositionTable) Store(hash uint64, move Move) {
+// Store an entry for the position. Mate scores are converted from being
+// relative to the root to being relative to the current ply, so they stay
+// correct when the entry is probed from a different ply.
+func (tt *TranspositionTable) Store(hash uint64, move Move, score int, depth int, flag uint8, ply int) {
 	index := hash % tt.Size
+	slot := &tt.Entries[index]
+	entry := slot.load()
+
+	// Keep deeper entries from the current search, unless the new entry
+	// is for the same position or is an exact score.
+	if entry.Hash != hash && entry.Age == tt.Age && depth < int(entry.Depth) && flag != ExactFlag {
+		return
+	}
+
+	// Don't lose the ordering move of a position when storing a fail low,
+	// which has no best move of its own.
+	if move == NoMove && entry.Hash == hash {
+		move = entry.Best
+	}
 
-	tt.Entries[index] = SearchEntry{
-		Hash: hash,
-		Best: move,
+	if score > ISMATE {
+		score += ply
+	} else if score < -ISMATE {
+		score -= ply
 	}
+
+	slot.store(SearchEntry{
+		Hash:  hash,
+		Best:  move & 0xffff0000,
+		Score: int16(score),
+		Depth: int8(depth),
+		Flag:  flag,
+		Age:   tt.Age,
+	})
 }
 
-func (tt *TranspositionTable) Probe(hash uint64) SearchEntry {
+// Probe the table for the position, reporting whether an entry was found.
+func (tt *TranspositionTable) Probe(hash uint64) (SearchEntry, bool) {
 	index := hash % tt.Size
+	entry := tt.Entries[index].load()
+
+	if entry.Hash != hash || entry.Flag == NoFlagTT {
+		return SearchEntry{}, false
+	}
+
+	return entry, true
+}
+
+// Get the entry's score adjusted back to being relative to the root.
+func (entry SearchEntry) ScoreAt(ply int) int {
+	score := int(entry.Score)
+
+	if score > ISMATE {
+		score -= ply
+	} else if score < -ISMATE {
+		score += ply
+	}
+
+	return score
+}
+
+// Start a new search generation, so entries of previous searches become
+// the first candidates to be replaced.
+func (tt *TranspositionTable) NewSearch() {
+	tt.Age++
+}
+
+// Hashfull estimates how much of the table is used by the current search,
+// in permill, by sampling the first thousand slots.
+func (tt *TranspositionTable) Hashfull() int {
+	samples := min(tt.Size, 1000)
+	used := 0
+
+	for i := uint64(0); i < samples; i++ {
+		entry := tt.Entries[i].load()
+
+		if entry.Flag != NoFlagTT && entry.Age == tt.Age {
+			used++
+		}
+	}
 
-	return tt.Entries[index]
+	return used * 1000 / int(samples)
 }
 
 func (tt *TranspositionTable) Clear() {
 	for i := uint64(0); i < tt.Size; i++ {
-		tt.Entries[i] = *new(SearchEntry)
+		tt.Entries[i] = ttSlot{}
+	}
+	tt.Age = 0
+}
+
+// The data word holds the move without its ordering score in bits 0-15,
+// then the score, depth, flag and age, one field after another.
+func (slot *ttSlot) load() SearchEntry {
+	key := atomic.LoadUint64(&slot.key)
+	data := atomic.LoadUint64(&slot.data)
+
+	return SearchEntry{
+		Hash:  key ^ data,
+		Best:  Move(data&0xffff) << 16,
+		Score: int16(data >> 16),
+		Depth: int8(data >> 32),
+		Flag:  uint8(data >> 40),
+		Age:   uint8(data >> 48),
 	}
 }
+
+func (slot *ttSlot) store(entry SearchEntry) {
+	data := uint64(entry.Best>>16) |
+		uint64(uint16(entry.Score))<<16 |
+		uint64(uint8(entry.Depth))<<32 |
+		uint64(entry.Flag)<<40 |
+		uint64(entry.Age)<<48
+
+	atomic.StoreUint64(&slot.key, entry.Hash^data)
+	atomic.StoreUint64(&slot.data, data)
+}
@@ -0,0 +1,111 @@
+package engine
+
+import "testing"
+
+func TestTTStoreProbe(t *testing.T) {
+	move := NewMove(E2, E4, Quiet, DoublePawnPush)
+	scored := move
+	scored.AddScore(1234)
+
+	tests := []struct {
+		name      string
+		move      Move
+		score     int
+		depth     int
+		flag      uint8
+		storePly  int
+		probePly  int
+		wantScore int
+	}{
+		{"exact score", move, 35, 7, ExactFlag, 3, 3, 35},
+		{"negative score", move, -412, 1, AlphaFlag, 0, 5, -412},
+		{"lower bound", move, 120, 12, BetaFlag, 10, 2, 120},
+		{"move score dropped", scored, 0, 4, ExactFlag, 2, 2, 0},
+		{"no move", NoMove, -5, 3, AlphaFlag, 1, 1, -5},
+		{"deepest depth", move, 1, MaxDepth - 1, ExactFlag, 0, 0, 1},
+
+		// Mate scores are stored as the distance from the position, so the
+		// same mate probed from another ply counts from there.
+		{"mate at the same ply", move, MateScore - 9, 5, ExactFlag, 4, 4, MateScore - 9},
+		{"mate probed closer to the root", move, MateScore - 9, 5, ExactFlag, 4, 2, MateScore - 7},
+		{"mate probed further from the root", move, MateScore - 9, 5, BetaFlag, 4, 8, MateScore - 13},
+		{"mated probed closer to the root", move, -MateScore + 6, 3, ExactFlag, 6, 1, -MateScore + 1},
+		{"mated probed further from the root", move, -MateScore + 6, 3, AlphaFlag, 6, 10, -MateScore + 10},
+	}
+
+	var tt TranspositionTable
+	tt.InitTransTable(1)
+
+	for i, test := range tests {
+		hash := 0x9e3779b97f4a7c15 * uint64(i+1)
+
+		tt.Store(hash, test.move, test.score, test.depth, test.flag, test.storePly)
+
+		entry, ok := tt.Probe(hash)
+		if !ok {
+			t.Errorf("%s: entry not found", test.name)
+			continue
+		}
+
+		if !entry.Best.Equal(test.move) || entry.Best.Score() != 0 {
+			t.Errorf("%s: move %v, want %v without a score", test.name, entry.Best, test.move)
+		}
+
+		if score := entry.ScoreAt(test.probePly); score != test.wantScore {
+			t.Errorf("%s: score %d, want %d", test.name, score, test.wantScore)
+		}
+
+		if int(entry.Depth) != test.depth || entry.Flag != test.flag || entry.Age != tt.Age {
+			t.Errorf("%s: depth %d flag %d age %d, want %d %d %d", test.name,
+				entry.Depth, entry.Flag, entry.Age, test.depth, test.flag, tt.Age)
+		}
+
+		if _, ok := tt.Probe(hash ^ 1<<63); ok {
+			t.Errorf("%s: entry found for another hash", test.name)
+		}
+	}
+}
+
+func TestTTReplacement(t *testing.T) {
+	var tt TranspositionTable
+	tt.InitTransTable(1)
+
+	// Two positions sharing a slot.
+	hash := uint64(12345)
+	other := hash + tt.Size
+	move := NewMove(G1, F3, Quiet, NoFlag)
+
+	tt.Store(hash, move, 50, 10, BetaFlag, 0)
+
+	// A shallower bound of another position doesn't replace a deeper entry
+	// of the current search, an exact score does.
+	tt.Store(other, NoMove, 10, 2, AlphaFlag, 0)
+	if entry, ok := tt.Probe(hash); !ok || entry.Depth != 10 {
+		t.Errorf("deeper entry replaced by a shallower bound")
+	}
+
+	tt.Store(other, NoMove, 10, 2, ExactFlag, 0)
+	if _, ok := tt.Probe(other); !ok {
+		t.Errorf("exact entry not stored")
+	}
+
+	// Entries of an earlier search are always replaced.
+	tt.Store(hash, move, 50, 10, BetaFlag, 0)
+	tt.NewSearch()
+	tt.Store(other, NoMove, 10, 1, AlphaFlag, 0)
+	if _, ok := tt.Probe(other); !ok {
+		t.Errorf("entry of an earlier search not replaced")
+	}
+
+	// A fail low keeps the best move of the position.
+	tt.Store(hash, move, 50, 3, BetaFlag, 0)
+	tt.Store(hash, NoMove, 20, 4, AlphaFlag, 0)
+	if entry, _ := tt.Probe(hash); !entry.Best.Equal(move) {
+		t.Errorf("best move %v lost by a fail low, want %v", entry.Best, move)
+	}
+
+	tt.Clear()
+	if _, ok := tt.Probe(hash); ok {
+		t.Errorf("entry found after clearing the table")
+	}
+}
@@ -0,0 +1,281 @@
+package engine
+
+import (
+	"bufio"
+	"fmt"
+	"math"
+	"os"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A position of the tuning data set, reduced to what the evaluation needs.
+type tuneEntry struct {
+	pieces [13]Bitboard
+	side   uint8
+
+	// The result of the game the position was taken from, from White's
+	// point of view: 1 for a win, 0.5 for a draw and 0 for a loss.
+	result float64
+}
+
+// Tune optimizes the evaluation parameters on a data set of positions
+// labeled with game results, the Texel tuning method. Each line of the
+// data set holds a FEN followed by the result, either as "1-0", "0-1" and
+// "1/2-1/2" or as "[1.0]", "[0.0]" and "[0.5]".
+//
+// Every position is replaced by the quiet position at the end of its
+// quiescence search first, so the evaluation is only ever asked about
+// positions without pending captures. Then the parameters are changed one
+// by one with a local search, keeping any change that lowers the error
+// between the game results and the results predicted from the evaluation.
+// The parameters are written to outputPath after every iteration, so the
+// tuning can be stopped at any time.
+func Tune(dataPath string, outputPath string) error {
+	start := time.Now()
+
+	entries, err := loadTuneEntries(dataPath)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Loaded %d positions in %v\n", len(entries), time.Since(start).Round(time.Millisecond))
+
+	k := tuneScalingConstant(entries)
+	bestError := tuneError(entries, k)
+
+	fmt.Printf("Scaling constant K : %.3f\n", k)
+	fmt.Printf("Initial error      : %.8f\n", bestError)
+
+	for iteration := 1; ; iteration++ {
+		improved := false
+
+		for p := range EvalParams {
+			param := &EvalParams[p]
+
+			for i := 0; i < param.Size(); i++ {
+				value := param.Get(i)
+
+				for _, delta := range [2]int{1, -1} {
+					param.Set(i, value+delta)
+					initPieceSquareScores()
+
+					if newError := tuneError(entries, k); newError < bestError {
+						bestError = newError
+						improved = true
+						break
+					}
+
+					param.Set(i, value)
+					initPieceSquareScores()
+				}
+			}
+		}
+
+		if err := SaveEvalParams(outputPath); err != nil {
+			return err
+		}
+
+		fmt.Printf("Iteration %d error %.8f time %v\n", iteration, bestError, time.Since(start).Round(time.Second))
+
+		if !improved {
+			break
+		}
+	}
+
+	fmt.Printf("Parameters written to %s\n", outputPath)
+	return nil
+}
+
+func loadTuneEntries(path string) ([]tuneEntry, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var entries []tuneEntry
+	var pos BoardStruct
+	var heur Heuristics
+
+	scanner := bufio.NewScanner(file)
+
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := scanner.Text()
+
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+
+		result, ok := parseTuneResult(line)
+		if !ok || len(strings.Fields(line)) < 4 {
+			return nil, fmt.Errorf("line %d: expected a FEN and a game result", lineNum)
+		}
+
+		// Only the first four fields are used, the result may follow them.
+		if err := pos.ParseFen(strings.Join(strings.Fields(line)[:4], " ")); err != nil {
+			return nil, fmt.Errorf("line %d: %v", lineNum, err)
+		}
+
+		var pv []Move
+		quiescencePv(-INFINITE, INFINITE, &pos, &heur, &pv)
+
+		for _, move := range pv {
+			pos.DoMove(move)
+		}
+
+		entries = append(entries, tuneEntry{pieces: pos.Pieces, side: pos.SideToMove, result: result})
+	}
+
+	return entries, scanner.Err()
+}
+
+func parseTuneResult(line string) (float64, bool) {
+	switch {
+	case strings.Contains(line, "1/2-1/2"), strings.Contains(line, "[0.5]"):
+		return 0.5, true
+	case strings.Contains(line, "1-0"), strings.Contains(line, "[1.0]"):
+		return 1, true
+	case strings.Contains(line, "0-1"), strings.Contains(line, "[0.0]"):
+		return 0, true
+	}
+
+	return 0, false
+}
+
+// Search the captures of the position like the quiescence search, without
+// the transposition table, and collect the principal variation leading to
+// the quiet position whose evaluation is the score of the search.
+func quiescencePv(alpha int, beta int, pos *BoardStruct, heur *Heuristics, pv *[]Move) int {
+	*pv = (*pv)[:0]
+
+	score := EvalPosition(pos)
+
+	if score >= beta || pos.Ply > MaxDepth-1 {
+		return score
+	}
+
+	if score > alpha {
+		alpha = score
+	}
+
+	var picker MovePicker
+	picker.Init(pos, heur, NoMove, false)
+
+	var childPv []Move
+
+	for move := picker.Next(); move != NoMove; move = picker.Next() {
+		pos.makeMove(move)
+
+		score = -quiescencePv(-beta, -alpha, pos, heur, &childPv)
+		pos.UndoMove()
+
+		if score > alpha {
+			*pv = append(append((*pv)[:0], move), childPv...)
+
+			if score >= beta {
+				return score
+			}
+			alpha = score
+		}
+	}
+
+	return alpha
+}
+
+// Find the scaling constant K of the sigmoid mapping evaluations to
+// expected results that fits the data set best with the current
+// parameters, narrowing the search down one decimal place at a time.
+func tuneScalingConstant(entries []tuneEntry) float64 {
+	best := 1.0
+	bestError := tuneError(entries, best)
+
+	for step := 0.1; step >= 0.001; step /= 10 {
+		center := best
+
+		for k := center - 10*step; k <= center+10*step; k += step {
+			if k <= 0 {
+				continue
+			}
+
+			if err := tuneError(entries, k); err < bestError {
+				best = k
+				bestError = err
+			}
+		}
+	}
+
+	return best
+}
+
+// Get the mean squared error between the game results and the results
+// predicted from the evaluation of the positions. The positions are split
+// between all CPUs.
+func tuneError(entries []tuneEntry, k float64) float64 {
+	workers := runtime.NumCPU()
+	chunkSize := (len(entries) + workers - 1) / workers
+	sums := make([]float64, workers)
+
+	var wg sync.WaitGroup
+
+	for worker := 0; worker < workers; worker++ {
+		first := min(worker*chunkSize, len(entries))
+		last := min(first+chunkSize, len(entries))
+
+		wg.Add(1)
+		go func(worker int, chunk []tuneEntry) {
+			defer wg.Done()
+
+			pos := new(BoardStruct)
+
+			for i := range chunk {
+				entry := &chunk[i]
+				entry.setup(pos)
+
+				eval := EvalPosition(pos)
+				if entry.side == Black {
+					eval = -eval
+				}
+
+				diff := entry.result - sigmoid(k, eval)
+				sums[worker] += diff * diff
+			}
+		}(worker, entries[first:last])
+	}
+
+	wg.Wait()
+
+	total := 0.0
+	for _, sum := range sums {
+		total += sum
+	}
+
+	return total / float64(max(len(entries), 1))
+}
+
+// Get the expected result of a position from its evaluation.
+func sigmoid(k float64, eval int) float64 {
+	return 1 / (1 + math.Pow(10, -k*float64(eval)/400))
+}
+
+// Fill in the bitboards of the position the evaluation looks at.
+func (entry *tuneEntry) setup(pos *BoardStruct) {
+	pos.Pieces = entry.pieces
+	pos.SideToMove = entry.side
+
+	pos.Pawns[White] = entry.pieces[wPawn]
+	pos.Pawns[Black] = entry.pieces[bPawn]
+	pos.Pawns[Both] = pos.Pawns[White] | pos.Pawns[Black]
+
+	pos.Sides[White] = 0
+	pos.Sides[Black] = 0
+
+	for pieceType := Pawn; pieceType <= King; pieceType++ {
+		pos.Sides[White] |= entry.pieces[AllPieces[White][pieceType]]
+		pos.Sides[Black] |= entry.pieces[AllPieces[Black][pieceType]]
+	}
+
+	pos.Sides[Both] = pos.Sides[White] | pos.Sides[Black]
+}
@@ -7,12 +7,26 @@ import (
 	"os"
 	"strconv"
 	"strings"
-	"time"
+	"sync"
 )
 
 type UCIInterface struct {
 	OpeningBook   map[uint64][]PolyEntry
 	OptionUseBook bool
+
+	// The NNUE network loaded by the "NNUEFile" option, used by the search
+	// once "UseNNUE" is on.
+	Network       *Network
+	OptionUseNNUE bool
+
+	// The directory of the endgame tablebases, where "tbgen" writes the
+	// tables it generates.
+	TablebasePath string
+
+	// searching tracks the goroutine running the current search, so the
+	// UCI loop keeps reading commands such as "stop" and "isready" while
+	// the engine is thinking.
+	searching sync.WaitGroup
 }
 
 func Uci() {
@@ -28,14 +42,26 @@ func Uci() {
 	var search Search
 	inter := UCIInterface{}
 	search.TT.InitTransTable(DefaultTableSize)
+	search.Threads = 1
+	search.MultiPV = 1
+	search.Time.MoveOverhead = DefaultMoveOverhead
+	search.Evaluator = ClassicalEvaluator{}
 
 	pos.ParseFen(FENStart)
 
 	for !quit {
-		cmd, _ := reader.ReadString('\n')
+		cmd, err := reader.ReadString('\n')
 
 		words := strings.Fields(cmd)
 
+		if len(words) == 0 {
+			if err != nil {
+				inter.stopSearch(&search)
+				quit = true
+			}
+			continue
+		}
+
 		switch words[0] {
 		case "uci":
 			inter.handleUci()
@@ -44,23 +70,85 @@ func Uci() {
 		case "position":
 			inter.parsePosition(cmd, &pos)
 		case "setoption":
-			inter.handleSetOption(cmd, search)
+			// The commands changing what the search uses stop a running
+			// search first. Waiting for it instead would hang after
+			// "go infinite", which only ends on "stop".
+			inter.stopSearch(&search)
+			inter.handleSetOption(cmd, &search)
 		case "ucinewgame":
+			inter.stopSearch(&search)
+			search.TT.Clear()
 			inter.parsePosition("position startpos\n", &pos)
 		case "go":
-			inter.handleGo(cmd, &search, &pos)
+			inter.startSearch(cmd, &search, &pos)
+		case "stop":
+			inter.stopSearch(&search)
 		case "help":
 			inter.handleHelp()
 		case "perft":
 			if len(words) >= 2 {
 				depth, _ := strconv.Atoi(words[1])
-				PerftTest(depth, &pos)
+				PerftTest(depth, &pos, len(words) >= 3 && words[2] == "legal")
+			}
+		case "perftcheck":
+			if len(words) >= 2 {
+				depth, _ := strconv.Atoi(words[1])
+				mismatches := PerftCheck(depth, &pos)
+				fmt.Printf("Positions with mismatches : %d\n", mismatches)
+			}
+		case "tbgen":
+			inter.stopSearch(&search)
+
+			path := inter.TablebasePath
+			if path == "" {
+				path = DefaultTablebasePath
+			}
+
+			for _, name := range words[1:] {
+				if err := GenerateTablebase(name, path); err != nil {
+					fmt.Println("Generating tablebase failed:", err)
+					break
+				}
+			}
+		case "tune":
+			// The tuner changes the weights the search evaluates with.
+			inter.stopSearch(&search)
+
+			if len(words) >= 2 {
+				output := "params.txt"
+				if len(words) >= 3 {
+					output = words[2]
+				}
+
+				if err := Tune(words[1], output); err != nil {
+					fmt.Println("Tuning failed:", err)
+				}
+			}
+		case "saveparams":
+			path := "params.txt"
+			if len(words) >= 2 {
+				path = words[1]
+			}
+
+			if err := SaveEvalParams(path); err == nil {
+				fmt.Printf("Parameters written to %s\n", path)
+			} else {
+				fmt.Println("Saving parameters failed:", err)
 			}
 		case "eval":
-			fmt.Printf("cp %d\n", EvalPosition(&pos))
+			if len(words) >= 2 && words[1] == "trace" {
+				fmt.Print(TraceEval(&pos).String(&pos))
+			} else {
+				evalPos := pos
+				search.Evaluator.Init(&evalPos)
+				fmt.Printf("cp %d\n", search.Evaluator.Evaluate(&evalPos))
+			}
+		case "evaltrace":
+			fmt.Print(TraceEval(&pos).String(&pos))
 		case "print":
 			fmt.Println(pos.String())
 		case "quit":
+			inter.stopSearch(&search)
 			quit = true
 		default:
 			fmt.Println("Unknown command ", strings.TrimRight(cmd, "\n"))
@@ -70,6 +158,31 @@ func Uci() {
 	}
 }
 
+// startSearch runs the search for a "go" command in its own goroutine on a
+// copy of the position, so the caller can go on handling input. A search
+// still running is stopped first.
+func (inter *UCIInterface) startSearch(cmd string, search *Search, pos *BoardStruct) {
+	inter.stopSearch(search)
+
+	searchPos := new(BoardStruct)
+	*searchPos = *pos
+
+	search.Stopped.Store(false)
+	inter.searching.Add(1)
+
+	go func() {
+		defer inter.searching.Done()
+		inter.handleGo(cmd, search, searchPos)
+	}()
+}
+
+// stopSearch signals a running search to stop and waits until it has
+// reported its best move.
+func (inter *UCIInterface) stopSearch(search *Search) {
+	search.Stopped.Store(true)
+	inter.searching.Wait()
+}
+
 func (inter *UCIInterface) parsePosition(cmd string, pos *BoardStruct) {
 	cmd = strings.TrimPrefix(cmd, "position")
 	cmd = strings.TrimPrefix(cmd, " ")
@@ -94,7 +207,18 @@ func (inter *UCIInterface) parsePosition(cmd string, pos *BoardStruct) {
 		return
 	}
 
-	pos.ParseFen(parts[0])
+	// Parse into a new board first, so an invalid FEN leaves the previous
+	// position in place.
+	newPos := new(BoardStruct)
+	newPos.Net = pos.Net
+	newPos.PawnTable = pos.PawnTable
+
+	if err := newPos.ParseFen(parts[0]); err != nil {
+		fmt.Println("info string Error", err.Error())
+		return
+	}
+
+	*pos = *newPos
 
 	if len(parts) == 2 {
 		parts[1] = strings.ToLower(strings.TrimSpace(parts[1]))
@@ -120,42 +244,56 @@ func (inter *UCIInterface) handleUci() {
 
 	fmt.Println("option name Hash type spin default 64 min 1 max 32000")
 	fmt.Println("option name Clear Hash type button")
+	fmt.Println("option name Threads type spin default 1 min 1 max 256")
+	fmt.Println("option name MultiPV type spin default 1 min 1 max 256")
+	fmt.Printf("option name Move Overhead type spin default %d min 0 max 5000\n", DefaultMoveOverhead)
 	fmt.Println("option name UseBook type check default false")
 	fmt.Println("option name BookPath type string default")
+	fmt.Println("option name EvalFile type string default")
+	fmt.Println("option name UseNNUE type check default false")
+	fmt.Println("option name NNUEFile type string default")
+	fmt.Println("option name TablebasePath type string default")
 	fmt.Println("uciok")
 }
 
 func (inter *UCIInterface) handleGo(cmd string, search *Search, pos *BoardStruct) {
+	cmd = strings.TrimPrefix(cmd, "go")
+	cmd = strings.TrimPrefix(cmd, " ")
+	words := strings.Fields(cmd)
+
+	search.Infinite = false
+	for _, word := range words {
+		if word == "infinite" {
+			search.Infinite = true
+		}
+	}
+
 	// If Opening book is enabled a random move will be logged instead of searching
 
 	if inter.OptionUseBook {
 		if inter.OpeningBook[PolyKeyFromBoard(pos)] != nil {
 			entries := inter.OpeningBook[PolyKeyFromBoard(pos)]
 
-			bestMove := entries[rand.Intn(len(entries))].Move
+			bestMove := ParseBookMove(entries[rand.Intn(len(entries))].Move, pos)
 
-			if ParseMove(bestMove, pos) != NoMove {
-				fmt.Printf("bestmove %s\n", bestMove)
+			if bestMove != NoMove {
+				search.waitForStop()
+				fmt.Printf("bestmove %s\n", bestMove.String())
 				return
 			}
 		}
 	}
 
-	cmd = strings.TrimPrefix(cmd, "go")
-	cmd = strings.TrimPrefix(cmd, " ")
-	words := strings.Fields(cmd)
-
 	depth := -1
-	movestogo := 30
+	mate := 0
+	nodes := 0
+	movestogo := -1
 	movetime := -1
 	gameTime := -1
 	inc := 0
-	search.Timeset = false
 
 	for i := 0; i < len(words)-1; i++ {
 		switch words[i] {
-
-		case "infinite":
 		case "binc":
 			if pos.SideToMove == Black {
 				inc, _ = strconv.Atoi(words[i+1])
@@ -178,33 +316,33 @@ func (inter *UCIInterface) handleGo(cmd string, search *Search, pos *BoardStruct
 			movetime, _ = strconv.Atoi(words[i+1])
 		case "depth":
 			depth, _ = strconv.Atoi(words[i+1])
-		}
-
-		if movetime != -1 {
-			gameTime = movetime
-			movestogo = 1
+		case "mate":
+			mate, _ = strconv.Atoi(words[i+1])
+		case "nodes":
+			nodes, _ = strconv.Atoi(words[i+1])
 		}
 	}
 
-	search.Starttime = time.Now().UnixMilli()
+	search.Time.Start(gameTime, inc, movestogo, movetime)
+	search.Time.NodeLimit = int64(nodes)
 	search.Depth = depth
 
-	if gameTime != -1 {
-		search.Timeset = true
-		gameTime /= movestogo
-		gameTime -= 50
-		search.Stoptime = search.Starttime + int64(gameTime) + int64(inc)
-	}
-
 	if depth == -1 {
 		search.Depth = MaxDepth
 	}
 
-	fmt.Printf("time:%d start:%d stop:%d depth:%d timeset:%t\n", gameTime, search.Starttime, search.Stoptime, search.Depth, search.Timeset)
+	// A mate in n moves is always found by a search of 2n plies.
+	search.Mate = mate
+	if mate > 0 && search.Depth > 2*mate {
+		search.Depth = 2 * mate
+	}
+
+	fmt.Printf("info string soft %d hard %d timeset %t depth %d nodes %d threads %d\n",
+		search.Time.SoftLimit(), search.Time.HardLimit(), search.Time.Timeset, search.Depth, nodes, max(search.Threads, 1))
 	search.SearchPosition(pos)
 }
 
-func (inter *UCIInterface) handleSetOption(cmd string, search Search) {
+func (inter *UCIInterface) handleSetOption(cmd string, search *Search) {
 	fields := strings.Fields(cmd)
 	var option, value string
 	parsingWhat := ""
@@ -232,24 +370,87 @@ func (inter *UCIInterface) handleSetOption(cmd string, search Search) {
 		}
 	case "Clear Hash":
 		search.TT.Clear()
+	case "Threads":
+		threads, err := strconv.Atoi(value)
+		if err == nil && threads >= 1 && threads <= 256 {
+			search.Threads = threads
+		}
+	case "Move Overhead":
+		overhead, err := strconv.Atoi(value)
+		if err == nil && overhead >= 0 && overhead <= 5000 {
+			search.Time.MoveOverhead = overhead
+		}
+	case "MultiPV":
+		multiPV, err := strconv.Atoi(value)
+		if err == nil && multiPV >= 1 && multiPV <= 256 {
+			search.MultiPV = multiPV
+		}
 	case "UseBook":
 		if value == "true" {
 			inter.OptionUseBook = true
 		} else if value == "false" {
 			inter.OptionUseBook = false
 		}
+	case "EvalFile":
+		if value == "" {
+			ResetEvalParams()
+			fmt.Println("info string Built-in evaluation parameters restored")
+		} else if err := LoadEvalParams(value); err == nil {
+			fmt.Println("info string Evaluation parameters loaded")
+		} else {
+			fmt.Println("info string Failed to load evaluation parameters:", err)
+		}
+	case "UseNNUE":
+		if value == "true" {
+			inter.OptionUseNNUE = true
+		} else if value == "false" {
+			inter.OptionUseNNUE = false
+		}
+		inter.updateEvaluator(search)
+	case "NNUEFile":
+		var err error
+		inter.Network, err = LoadNetwork(value)
+
+		if err == nil {
+			fmt.Println("info string NNUE network loaded")
+		} else {
+			fmt.Println("info string Failed to load NNUE network:", err)
+		}
+		inter.updateEvaluator(search)
+	case "TablebasePath":
+		inter.TablebasePath = value
+		count, err := LoadTablebases(value)
+
+		if err == nil {
+			fmt.Printf("info string %d tablebases loaded\n", count)
+		} else {
+			fmt.Println("info string Failed to load tablebases:", err)
+		}
 	case "BookPath":
 		var err error
 		inter.OpeningBook, err = LoadPolyglotFile(value)
 
 		if err == nil {
-			fmt.Println("Opening book loaded...")
+			fmt.Println("info string Opening book loaded")
 		} else {
-			fmt.Println("Failed to load opening book...")
+			fmt.Println("info string Failed to load opening book:", err)
 		}
 	}
 }
 
+// updateEvaluator switches the search to NNUE if it is turned on and a
+// network is loaded, and to the classical evaluation otherwise.
+func (inter *UCIInterface) updateEvaluator(search *Search) {
+	if inter.OptionUseNNUE && inter.Network != nil {
+		search.Evaluator = NNUEEvaluator{Net: inter.Network}
+	} else {
+		if inter.OptionUseNNUE {
+			fmt.Println("info string No NNUE network loaded, using the classical evaluation")
+		}
+		search.Evaluator = ClassicalEvaluator{}
+	}
+}
+
 func (inter *UCIInterface) handleHelp() {
 	fmt.Println("\nAvailable Commands: ")
 	fmt.Println("\t- uci")
@@ -268,13 +469,23 @@ func (inter *UCIInterface) handleHelp() {
 	fmt.Println("\t\t- movetime <MILLISECONDS>")
 
 	fmt.Println("\t\t- depth <INTEGER>")
+	fmt.Println("\t\t- mate <MOVES>")
+	fmt.Println("\t\t- nodes <INTEGER>")
 	fmt.Println("\t\t- movestogo <INTEGER>")
 
-	fmt.Println("\t\t- Infinity")
+	fmt.Println("\t\t- infinite")
+
+	fmt.Println("\t- stop")
+	fmt.Println("\t- isready")
 
 	fmt.Println("\t- print")
-	fmt.Println("\t- perft <DEPTH>")
-	fmt.Println("\t- eval")
+	fmt.Println("\t- perft <DEPTH> [legal]")
+	fmt.Println("\t- perftcheck <DEPTH>")
+	fmt.Println("\t- eval [trace]")
+	fmt.Println("\t- evaltrace")
+	fmt.Println("\t- tune <DATASET> [<OUTPUT>]")
+	fmt.Println("\t- saveparams [<FILE>]")
+	fmt.Println("\t- tbgen <SIGNATURE>...")
 
 	fmt.Println("\t- help")
 	fmt.Println("\t- quit")
@@ -0,0 +1,28 @@
+package engine
+
+import "testing"
+
+func TestParsePosition(t *testing.T) {
+	var inter UCIInterface
+	pos := new(BoardStruct)
+
+	inter.parsePosition("position startpos moves e2e4 e7e5", pos)
+	want := "rnbqkbnr/pppp1ppp/8/4p3/4P3/8/PPPP1PPP/RNBQKBNR w KQkq e6 0 2"
+
+	if fen := pos.FEN(); fen != want {
+		t.Fatalf("position after e2e4 e7e5 %s, want %s", fen, want)
+	}
+
+	// An invalid FEN leaves the previous position in place.
+	for _, cmd := range []string{
+		"position fen garbage",
+		"position fen 8/8/8/8/8/8/8/8 w - - 0 1",
+		"position fen rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR x KQkq - 0 1 moves e2e4",
+	} {
+		inter.parsePosition(cmd, pos)
+
+		if fen := pos.FEN(); fen != want {
+			t.Errorf("%q changed the position to %s", cmd, fen)
+		}
+	}
+}
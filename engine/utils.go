@@ -75,6 +75,11 @@ func RankOf(sq int) int {
 	return sq / 8
 }
 
+// Get the number of king moves between the two squares.
+func SquareDistance(sq1 int, sq2 int) int {
+	return max(abs(FileOf(sq1)-FileOf(sq2)), abs(RankOf(sq1)-RankOf(sq2)))
+}
+
 func Mirror(sq int) int {
 	return Mirror64[sq]
 }
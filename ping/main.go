@@ -1,6 +1,9 @@
 package main
 
 import (
+	"fmt"
+	"os"
+
 	"ping/engine"
 )
 
@@ -11,11 +14,21 @@ func Init() {
 	engine.InitEvalMasks()
 	engine.InitMvvLva()
 	engine.InitMagic()
+	engine.InitLineMasks()
+	engine.InitReductions()
 
 }
 
 func main() {
 	Init()
 
+	if len(os.Args) > 1 && os.Args[1] == "makebook" {
+		if err := makeBook(os.Args[2:]); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	engine.Uci()
 }
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+
+	"ping/engine"
+	"ping/engine/pgn"
+)
+
+// Build a Polyglot book from PGN files:
+//
+//	ping makebook [-plies N] [-mingames N] [-minelo N] [-out FILE] <PGN>...
+//
+// The moves of the main lines up to the ply limit are counted with the
+// results of the games. When a minimum rating is given, the moves of
+// players rated below it or not rated at all are skipped.
+func makeBook(args []string) error {
+	flags := flag.NewFlagSet("makebook", flag.ExitOnError)
+	plies := flags.Int("plies", 20, "the number of plies of each game to add")
+	minGames := flags.Int("mingames", 3, "the number of games a move needs to be played in")
+	minElo := flags.Int("minelo", 0, "the rating a player needs for their moves to be added")
+	output := flags.String("out", "book.bin", "the book file to write")
+	flags.Parse(args)
+
+	if flags.NArg() == 0 {
+		return fmt.Errorf("usage: ping makebook [-plies N] [-mingames N] [-minelo N] [-out FILE] <PGN>...")
+	}
+
+	builder := engine.NewBookBuilder(*minGames)
+	games, skipped := 0, 0
+
+	for _, path := range flags.Args() {
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+
+		reader := pgn.NewReader(file)
+
+		for {
+			game, err := reader.Next()
+			if err == io.EOF {
+				break
+			} else if err != nil {
+				fmt.Printf("%s: %v\n", path, err)
+				skipped++
+				continue
+			}
+
+			if addBookGame(builder, game, *plies, *minElo) {
+				games++
+			} else {
+				skipped++
+			}
+		}
+
+		file.Close()
+	}
+
+	entries, err := builder.Write(*output)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Added %d games, skipped %d\n", games, skipped)
+	fmt.Printf("Written %d entries to %s\n", entries, *output)
+	return nil
+}
+
+// Add the moves of the main line of the game to the book. Games without a
+// result are left out.
+func addBookGame(builder *engine.BookBuilder, game *pgn.Game, plies int, minElo int) bool {
+	var whiteScore float64
+
+	switch game.Result {
+	case pgn.WhiteWins:
+		whiteScore = 1
+	case pgn.BlackWins:
+		whiteScore = 0
+	case pgn.Draw:
+		whiteScore = 0.5
+	default:
+		return false
+	}
+
+	pos, err := game.StartPosition()
+	if err != nil {
+		return false
+	}
+
+	rated := [2]bool{
+		minElo <= 0 || playerElo(game, "WhiteElo") >= minElo,
+		minElo <= 0 || playerElo(game, "BlackElo") >= minElo,
+	}
+
+	for ply, move := range game.MainLine() {
+		if ply >= plies {
+			break
+		}
+
+		if rated[pos.SideToMove] {
+			score := whiteScore
+			if pos.SideToMove == engine.Black {
+				score = 1 - whiteScore
+			}
+
+			builder.Add(pos, move, score)
+		}
+
+		pos.DoMove(move)
+	}
+
+	return true
+}
+
+// Get the rating of a player, 0 if the game doesn't have it.
+func playerElo(game *pgn.Game, tag string) int {
+	elo, err := strconv.Atoi(game.Tag(tag))
+	if err != nil {
+		return 0
+	}
+
+	return elo
+}